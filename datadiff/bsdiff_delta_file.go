@@ -0,0 +1,161 @@
+package datadiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// BSDIFF40 delta format of bsdiff 4
+const (
+	BSDIFF_MAGIC = "BSDIFF40"
+
+	// bsdiffHeaderSize is the size of magic followed by sizes of compressed control and diff streams and new file
+	bsdiffHeaderSize = 32
+)
+
+// diffDeltaBuffer is DeltaBuffer that can write data as bytewise differences to basis data
+type diffDeltaBuffer interface {
+	DeltaBuffer
+
+	// addDiff writes command that adds diff bytewise to basis data from start
+	addDiff(start uint64, diff []byte)
+}
+
+// BsdiffDelta writes BSDIFF40 delta. Control triples, diff bytes and extra bytes are compressed to three bzip2
+// streams in memory until Close, as the header has the sizes of compressed streams.
+type BsdiffDelta struct {
+	w io.Writer
+
+	ctrl, diff, extra    bytes.Buffer
+	ctrlZ, diffZ, extraZ *bzip2Writer
+
+	// Control triple which is not yet written: x bytes of diff followed by y bytes of extra. Basis position after the
+	// diff bytes is oldPos.
+	x, y   uint64
+	oldPos uint64
+
+	newSize uint64
+	zeros   []byte
+}
+
+// NewBsdiffDelta initiates BSDIFF40 delta buffer writing to w. Copies are written as diffs of zero bytes.
+func NewBsdiffDelta(w io.Writer) DeltaBuffer {
+	return newBsdiffDelta(w)
+}
+
+// newBsdiffDelta creates BsdiffDelta writing to w
+func newBsdiffDelta(w io.Writer) *BsdiffDelta {
+	dw := &BsdiffDelta{w: w}
+	dw.ctrlZ = newBzip2Writer(&dw.ctrl)
+	dw.diffZ = newBzip2Writer(&dw.diff)
+	dw.extraZ = newBzip2Writer(&dw.extra)
+
+	return dw
+}
+
+// Close writes the last control triple and the delta. Streams are written to memory, so write errors come from w.
+func (dw *BsdiffDelta) Close() error {
+	if dw.x > 0 || dw.y > 0 {
+		dw.writeCtrl(0)
+	}
+
+	for _, z := range []*bzip2Writer{dw.ctrlZ, dw.diffZ, dw.extraZ} {
+		err := z.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	var header = make([]byte, bsdiffHeaderSize)
+	copy(header, BSDIFF_MAGIC)
+	putBsdiffInt(header[8:], int64(dw.ctrl.Len()))
+	putBsdiffInt(header[16:], int64(dw.diff.Len()))
+	putBsdiffInt(header[24:], int64(dw.newSize))
+
+	for _, b := range [][]byte{header, dw.ctrl.Bytes(), dw.diff.Bytes(), dw.extra.Bytes()} {
+		_, err := dw.w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddLiteral writes data to extra stream
+func (dw *BsdiffDelta) AddLiteral(data []byte) {
+	dw.y += uint64(len(data))
+	dw.newSize += uint64(len(data))
+	dw.extraZ.Write(data)
+}
+
+// AddCopy writes length zero bytes to diff stream
+func (dw *BsdiffDelta) AddCopy(start, length uint64) {
+	dw.addCtrl(start, length)
+
+	if dw.zeros == nil {
+		dw.zeros = make([]byte, 32*1024)
+	}
+	for length > 0 {
+		n := uint64(len(dw.zeros))
+		if n > length {
+			n = length
+		}
+		dw.diffZ.Write(dw.zeros[:n])
+		length -= n
+	}
+}
+
+// addDiff implements diffDeltaBuffer
+func (dw *BsdiffDelta) addDiff(start uint64, diff []byte) {
+	dw.addCtrl(start, uint64(len(diff)))
+	dw.diffZ.Write(diff)
+}
+
+// addCtrl adds length bytes of diff from start of basis to control triples. Diff continues the pending triple if
+// it has no extra and basis position does not change.
+func (dw *BsdiffDelta) addCtrl(start, length uint64) {
+	if length == 0 {
+		return
+	}
+
+	if dw.y > 0 || start != dw.oldPos {
+		dw.writeCtrl(int64(start - dw.oldPos))
+		dw.x, dw.y = 0, 0
+	}
+
+	dw.x += length
+	dw.oldPos = start + length
+	dw.newSize += length
+}
+
+// writeCtrl writes the pending control triple which moves basis position by seek after its diff
+func (dw *BsdiffDelta) writeCtrl(seek int64) {
+	var triple [24]byte
+	putBsdiffInt(triple[0:], int64(dw.x))
+	putBsdiffInt(triple[8:], int64(dw.y))
+	putBsdiffInt(triple[16:], seek)
+
+	dw.ctrlZ.Write(triple[:])
+}
+
+// putBsdiffInt writes n to b as 8 byte little endian sign and magnitude integer
+func putBsdiffInt(b []byte, n int64) {
+	if n < 0 {
+		binary.LittleEndian.PutUint64(b, uint64(-n)|1<<63)
+		return
+	}
+
+	binary.LittleEndian.PutUint64(b, uint64(n))
+}
+
+// bsdiffInt reads 8 byte little endian sign and magnitude integer from b
+func bsdiffInt(b []byte) int64 {
+	var n = int64(binary.LittleEndian.Uint64(b) &^ (1 << 63))
+	if b[7]&0x80 != 0 {
+		return -n
+	}
+
+	return n
+}
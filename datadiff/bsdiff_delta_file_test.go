@@ -0,0 +1,152 @@
+package datadiff
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bsdiffControls returns control triples as integers
+func bsdiffControls(triples ...int64) string {
+	var b = make([]byte, 8*len(triples))
+	for i, n := range triples {
+		putBsdiffInt(b[8*i:], n)
+	}
+	return string(b)
+}
+
+// bsdiffStreams returns decompressed control, diff and extra streams and new file size of BSDIFF40 delta
+func bsdiffStreams(t *testing.T, delta []byte) (ctrl, diff, extra string, newSize int64) {
+	assert.Equal(t, BSDIFF_MAGIC, string(delta[:8]), "Delta should start with magic")
+
+	ctrlLen, diffLen := bsdiffInt(delta[8:]), bsdiffInt(delta[16:])
+	var streams []string
+	for _, b := range [][]byte{
+		delta[bsdiffHeaderSize : bsdiffHeaderSize+ctrlLen],
+		delta[bsdiffHeaderSize+ctrlLen : bsdiffHeaderSize+ctrlLen+diffLen],
+		delta[bsdiffHeaderSize+ctrlLen+diffLen:],
+	} {
+		data, err := io.ReadAll(bzip2.NewReader(bytes.NewReader(b)))
+		assert.NoError(t, err, "Stream should be bzip2 compressed")
+		streams = append(streams, string(data))
+	}
+
+	return streams[0], streams[1], streams[2], bsdiffInt(delta[24:])
+}
+
+func TestBsdiffDelta(t *testing.T) {
+	var tests = []struct {
+		name            string
+		commands        func(dw *BsdiffDelta)
+		expectedCtrl    string
+		expectedDiff    string
+		expectedExtra   string
+		expectedNewSize int64
+	}{
+		{
+			name:     "Empty delta",
+			commands: func(dw *BsdiffDelta) {},
+		},
+		{
+			name: "Literal and copy",
+			commands: func(dw *BsdiffDelta) {
+				dw.AddLiteral([]byte("hello"))
+				dw.AddCopy(10, 3)
+			},
+			expectedCtrl:    bsdiffControls(0, 5, 10, 3, 0, 0),
+			expectedDiff:    "\x00\x00\x00",
+			expectedExtra:   "hello",
+			expectedNewSize: 8,
+		},
+		{
+			name: "Consecutive diffs are combined",
+			commands: func(dw *BsdiffDelta) {
+				dw.AddCopy(0, 2)
+				dw.addDiff(2, []byte{1, 2})
+				dw.AddLiteral([]byte("ab"))
+				dw.AddLiteral([]byte("c"))
+			},
+			expectedCtrl:    bsdiffControls(4, 3, 0),
+			expectedDiff:    "\x00\x00\x01\x02",
+			expectedExtra:   "abc",
+			expectedNewSize: 7,
+		},
+		{
+			name: "Diffs seek basis",
+			commands: func(dw *BsdiffDelta) {
+				dw.addDiff(100, []byte{1})
+				dw.AddCopy(50, 2)
+				dw.addDiff(52, nil)
+				dw.AddCopy(52, 1)
+			},
+			expectedCtrl:    bsdiffControls(0, 0, 100, 1, 0, -51, 3, 0, 0),
+			expectedDiff:    "\x01\x00\x00\x00",
+			expectedNewSize: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+
+			dw := newBsdiffDelta(buf)
+			tt.commands(dw)
+
+			err := dw.Close()
+			assert.NoError(t, err, "Close should not return error")
+
+			ctrl, diff, extra, newSize := bsdiffStreams(t, buf.Bytes())
+			assert.Equal(t, tt.expectedCtrl, ctrl, "Control triples should be as expected")
+			assert.Equal(t, tt.expectedDiff, diff, "Diff bytes should be as expected")
+			assert.Equal(t, tt.expectedExtra, extra, "Extra bytes should be as expected")
+			assert.Equal(t, tt.expectedNewSize, newSize, "New file size should be as expected")
+		})
+	}
+}
+
+func TestBsdiffInt(t *testing.T) {
+	var tests = []struct {
+		n        int64
+		expected string
+	}{
+		{n: 0, expected: "\x00\x00\x00\x00\x00\x00\x00\x00"},
+		{n: 0x0102, expected: "\x02\x01\x00\x00\x00\x00\x00\x00"},
+		{n: -1, expected: "\x01\x00\x00\x00\x00\x00\x00\x80"},
+		{n: -0x0102, expected: "\x02\x01\x00\x00\x00\x00\x00\x80"},
+	}
+
+	for _, tt := range tests {
+		var b = make([]byte, 8)
+		putBsdiffInt(b, tt.n)
+		assert.Equal(t, []byte(tt.expected), b, "Integer %d should be sign and magnitude", tt.n)
+		assert.Equal(t, tt.n, bsdiffInt(b), "Integer should be read back")
+	}
+
+	var b = make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, 1<<63)
+	assert.Equal(t, int64(0), bsdiffInt(b), "Negative zero should be zero")
+}
+
+func TestBsdiffDeltaFormat(t *testing.T) {
+	var basis = []byte(strings.Repeat("Some basis data. ", 1000))
+	var modified = []byte(strings.Replace(string(basis), "basis", "basic", -1))
+
+	sig := &bytes.Buffer{}
+	err := Signature(bytes.NewReader(basis), sig, SignatureOptions{})
+	assert.NoError(t, err, "Signature should not return error")
+
+	delta := &bytes.Buffer{}
+	err = Delta(sig, bytes.NewReader(modified), delta, DeltaOptions{Format: FormatBsdiff})
+	assert.NoError(t, err, "Delta should not return error")
+	assert.Equal(t, BSDIFF_MAGIC, delta.String()[:8], "Delta should be in BSDIFF40 format")
+
+	got := &bytes.Buffer{}
+	err = Patch(bytes.NewReader(basis), delta, got, PatchOptions{})
+	assert.NoError(t, err, "Patch should not return error")
+	assert.Equal(t, string(modified), got.String(), "Patched data should equal to new file")
+}
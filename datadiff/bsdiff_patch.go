@@ -0,0 +1,151 @@
+package datadiff
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io"
+)
+
+// bsdiffControl is control triple of BSDIFF40 delta
+type bsdiffControl struct {
+	// diff bytes are added to basis data and extra bytes follow them in new file
+	diff, extra int64
+
+	// seek moves basis position after diff bytes
+	seek int64
+}
+
+// bsdiffReader reads header and control triples of BSDIFF40 delta
+type bsdiffReader struct {
+	newSize int64
+
+	ctrl, diff, extra io.Reader
+}
+
+// newBsdiffReader reads header of BSDIFF40 delta from r. Compressed control and diff streams are read to memory, and
+// extra stream is decompressed from the rest of r.
+func newBsdiffReader(r *bufio.Reader) (*bsdiffReader, error) {
+	var header = make([]byte, bsdiffHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read BSDIFF40 header: %s", noEOF(err).Error())
+	}
+	if string(header[:8]) != BSDIFF_MAGIC {
+		return nil, fmt.Errorf("%s file is not a BSDIFF40 delta", argDelta)
+	}
+
+	ctrlLen, diffLen, newSize := bsdiffInt(header[8:]), bsdiffInt(header[16:]), bsdiffInt(header[24:])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 {
+		return nil, fmt.Errorf("invalid BSDIFF40 header: negative size")
+	}
+
+	var streams [2]bytes.Buffer
+	for i, size := range []int64{ctrlLen, diffLen} {
+		_, err = io.CopyN(&streams[i], r, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read BSDIFF40 streams: %s", noEOF(err).Error())
+		}
+	}
+
+	return &bsdiffReader{
+		newSize: newSize,
+		ctrl:    bzip2.NewReader(&streams[0]),
+		diff:    bzip2.NewReader(&streams[1]),
+		extra:   bzip2.NewReader(r),
+	}, nil
+}
+
+// next reads the next control triple. Triples after new file size are not read.
+func (br *bsdiffReader) next(newPos int64) (c bsdiffControl, err error) {
+	var triple [24]byte
+	_, err = io.ReadFull(br.ctrl, triple[:])
+	if err != nil {
+		return c, fmt.Errorf("failed to read BSDIFF40 control: %s", noEOF(err).Error())
+	}
+
+	c = bsdiffControl{diff: bsdiffInt(triple[0:]), extra: bsdiffInt(triple[8:]), seek: bsdiffInt(triple[16:])}
+	if c.diff < 0 || c.extra < 0 || c.diff > br.newSize-newPos || c.extra > br.newSize-newPos-c.diff {
+		return c, fmt.Errorf("BSDIFF40 control [%d, %d] exceeds new file size %d", c.diff, c.extra, br.newSize)
+	}
+
+	return c, nil
+}
+
+// applyBsdiffPatch reconstructs new file to out by applying BSDIFF40 delta to basis file. Like bspatch, diff bytes
+// outside of basis file are not added to basis data.
+func applyBsdiffPatch(basis io.ReaderAt, r *bufio.Reader, out io.Writer, log *logger) error {
+	br, err := newBsdiffReader(r)
+	if err != nil {
+		return err
+	}
+
+	var buf = make([]byte, 2*32*1024)
+	var diffBuf, oldBuf = buf[:len(buf)/2], buf[len(buf)/2:]
+	var newPos, oldPos int64
+	for newPos < br.newSize {
+		c, err := br.next(newPos)
+		if err != nil {
+			return err
+		}
+		log.println("DIFF", oldPos, c.diff, "EXTRA", c.extra, "SEEK", c.seek)
+
+		for remaining := c.diff; remaining > 0; {
+			d := diffBuf
+			if int64(len(d)) > remaining {
+				d = d[:remaining]
+			}
+
+			_, err = io.ReadFull(br.diff, d)
+			if err != nil {
+				return fmt.Errorf("failed to read BSDIFF40 diff: %s", noEOF(err).Error())
+			}
+
+			err = addBasis(d, basis, oldPos, oldBuf)
+			if err != nil {
+				return err
+			}
+
+			_, err = out.Write(d)
+			if err != nil {
+				return fmt.Errorf("failed to write %s file: %s", argNewFile, err.Error())
+			}
+
+			oldPos += int64(len(d))
+			remaining -= int64(len(d))
+		}
+
+		n, err := io.CopyN(out, br.extra, c.extra)
+		if err != nil {
+			return fmt.Errorf("failed to read BSDIFF40 extra (%d of %d bytes): %s", n, c.extra, noEOF(err).Error())
+		}
+
+		newPos += c.diff + c.extra
+		oldPos += c.seek
+	}
+
+	return nil
+}
+
+// addBasis adds basis data from oldPos bytewise to d. Basis data before the start or after the end of basis file is
+// left out. Buffer of basis data is at least as long as d.
+func addBasis(d []byte, basis io.ReaderAt, oldPos int64, buf []byte) error {
+	if oldPos < 0 {
+		if -oldPos >= int64(len(d)) {
+			return nil
+		}
+		d, oldPos = d[-oldPos:], 0
+	}
+
+	n, err := basis.ReadAt(buf[:len(d)], oldPos)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read %s file: %s", argOldFile, err.Error())
+	}
+
+	for i, b := range buf[:n] {
+		d[i] += b
+	}
+
+	return nil
+}
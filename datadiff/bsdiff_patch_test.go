@@ -0,0 +1,133 @@
+package datadiff
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bsdiffBytes returns BSDIFF40 delta of uncompressed control, diff and extra streams
+func bsdiffBytes(newSize int64, ctrl, diff, extra string) []byte {
+	var streams [3]bytes.Buffer
+	for i, data := range []string{ctrl, diff, extra} {
+		z := newBzip2Writer(&streams[i])
+		z.Write([]byte(data))
+		z.Close()
+	}
+
+	var header = make([]byte, bsdiffHeaderSize)
+	copy(header, BSDIFF_MAGIC)
+	putBsdiffInt(header[8:], int64(streams[0].Len()))
+	putBsdiffInt(header[16:], int64(streams[1].Len()))
+	putBsdiffInt(header[24:], newSize)
+
+	return joinChunks(string(header), streams[0].String(), streams[1].String(), streams[2].String())
+}
+
+func TestApplyBsdiffPatch(t *testing.T) {
+	var basis = []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	var tests = []struct {
+		name        string
+		delta       []byte
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "Empty delta",
+			delta:    bsdiffBytes(0, "", "", ""),
+			expected: "",
+		},
+		{
+			name: "Diff, extra and seek",
+			delta: bsdiffBytes(9,
+				bsdiffControls(3, 2, 7, 4, 0, 0),
+				"\x00\x01\x00\x00\x00\x00\xff",
+				"XY"),
+			expected: "022XYabcc",
+		},
+		{
+			name: "Diff outside of basis is not added",
+			delta: bsdiffBytes(4,
+				bsdiffControls(0, 0, -2, 4, 0, 0),
+				"ab\x01\x01",
+				""),
+			expected: "ab12",
+		},
+		{
+			name: "Diff after the end of basis",
+			delta: bsdiffBytes(3,
+				bsdiffControls(0, 0, 34, 3, 0, 0),
+				"\x00\x00A",
+				""),
+			expected: "yzA",
+		},
+		{
+			name:     "Triples after new file size are not read",
+			delta:    bsdiffBytes(1, bsdiffControls(0, 1, 0)+"garbage", "", "!"),
+			expected: "!",
+		},
+		{
+			name:        "Wrong magic",
+			delta:       joinChunks("BSDIFF41", string(make([]byte, 24))),
+			expectedErr: "DELTA file is not a BSDIFF40 delta",
+		},
+		{
+			name:        "Truncated header",
+			delta:       []byte(BSDIFF_MAGIC),
+			expectedErr: "failed to read BSDIFF40 header: unexpected EOF",
+		},
+		{
+			name:        "Negative size",
+			delta:       joinChunks(BSDIFF_MAGIC, bsdiffControls(0, 0, -1)),
+			expectedErr: "invalid BSDIFF40 header: negative size",
+		},
+		{
+			name:        "Missing streams",
+			delta:       joinChunks(BSDIFF_MAGIC, bsdiffControls(100, 0, 0)),
+			expectedErr: "failed to read BSDIFF40 streams: unexpected EOF",
+		},
+		{
+			name:        "Missing control",
+			delta:       bsdiffBytes(3, bsdiffControls(1, 1), "", ""),
+			expectedErr: "failed to read BSDIFF40 control: unexpected EOF",
+		},
+		{
+			name:        "Control exceeds new file size",
+			delta:       bsdiffBytes(3, bsdiffControls(2, 2, 0), "\x00\x00", "ab"),
+			expectedErr: "BSDIFF40 control [2, 2] exceeds new file size 3",
+		},
+		{
+			name:        "Negative length",
+			delta:       bsdiffBytes(3, bsdiffControls(-1, 2, 0), "", ""),
+			expectedErr: "BSDIFF40 control [-1, 2] exceeds new file size 3",
+		},
+		{
+			name:        "Truncated diff",
+			delta:       bsdiffBytes(3, bsdiffControls(3, 0, 0), "\x00", ""),
+			expectedErr: "failed to read BSDIFF40 diff: unexpected EOF",
+		},
+		{
+			name:        "Truncated extra",
+			delta:       bsdiffBytes(3, bsdiffControls(0, 3, 0), "", "a"),
+			expectedErr: "failed to read BSDIFF40 extra (1 of 3 bytes): unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &bytes.Buffer{}
+			err := applyBsdiffPatch(bytes.NewReader(basis), bufio.NewReader(bytes.NewReader(tt.delta)), got, nil)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "applyBsdiffPatch should not return error")
+			assert.Equal(t, tt.expected, got.String(), "Patched data should be as expected")
+		})
+	}
+}
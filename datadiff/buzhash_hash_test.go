@@ -0,0 +1,159 @@
+package datadiff
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"math/bits"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuzhashTable(t *testing.T) {
+	// Chunks of stored buzhash signatures with default table depend on the table
+	assert.Equal(t, uint32(0x2e617cab), defaultBuzhashTable[0], "First value of buzhash table should not change")
+	assert.Equal(t, uint32(0xd6daeacd), defaultBuzhashTable[1], "Second value of buzhash table should not change")
+	assert.Equal(t, uint32(0x5c517ad8), defaultBuzhashTable[255], "Last value of buzhash table should not change")
+
+	table, err := newBuzhashTable(nil, 0x12345678)
+	assert.NoError(t, err, "newBuzhashTable should not return error")
+	assert.Equal(t, defaultBuzhashTable[7]^0x12345678, table[7], "Values should be XORed with seed")
+
+	seed, ok := table.seed()
+	assert.True(t, ok, "Table should be created from default table")
+	assert.Equal(t, uint32(0x12345678), seed, "Seed should be found from table")
+
+	var values = make([]uint32, 256)
+	for i := range values {
+		values[i] = uint32(i)
+	}
+
+	table, err = newBuzhashTable(values, 1)
+	assert.NoError(t, err, "newBuzhashTable should not return error")
+	assert.Equal(t, uint32(7^1), table[7], "Values should be from given table")
+
+	_, ok = table.seed()
+	assert.False(t, ok, "Custom table should not have seed")
+
+	_, err = newBuzhashTable(values[:255], 0)
+	assert.EqualError(t, err, "buzhash table has to have 256 values: 255")
+}
+
+func TestBuzhash(t *testing.T) {
+	var data = make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	hashes := defaultBuzhashTable.calc(data, nil)
+
+	assert.Len(t, hashes, len(data)-buzhashWindowSize+1, "There should be hash for each window")
+	assert.Equal(t, uint64(0x469902e7), hashes[0], "Hash of first window should not change")
+	assert.Equal(t, uint64(0x2a724d6c), hashes[len(hashes)-1], "Hash of last window should not change")
+}
+
+func TestBuzhashWindow(t *testing.T) {
+	var data = make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	table, err := newBuzhashTable(nil, 0xdeadbeef)
+	assert.NoError(t, err, "newBuzhashTable should not return error")
+
+	hashes := table.calc(data, nil)
+
+	for i := buzhashWindowSize - 1; i < len(data); i++ {
+		// Hash is XOR of table values rotated by their distance from the end of window
+		var expected uint32
+		for j, b := range data[i-buzhashWindowSize+1 : i+1] {
+			expected ^= bits.RotateLeft32(table[b], buzhashWindowSize-1-j)
+		}
+
+		assert.Equal(t, uint64(expected), hashes[i-buzhashWindowSize+1], "Hash of window ending at %d should match", i)
+	}
+}
+
+func TestBuzhashShortData(t *testing.T) {
+	for _, size := range []int{0, 1, buzhashWindowSize - 1} {
+		hashes := defaultBuzhashTable.calc(make([]byte, size), []uint64{7})
+
+		assert.Equal(t, []uint64{7}, hashes, "Data of %d bytes should have no windows", size)
+	}
+
+	assert.Len(t, defaultBuzhashTable.calc(make([]byte, buzhashWindowSize), nil), 1,
+		"Data of window size should have one window")
+}
+
+func TestBuzhashChunksCasync(t *testing.T) {
+	// Chunks of casync's chunker.input test file found by desync with default sizes: start, size and SHA-512/256 of
+	// data
+	var expected = []struct {
+		start  uint64
+		size   uint64
+		digest string
+	}{
+		{0, 81590, "ad951d7f65c27828ce390f3c81c41d75f80e4527169ad072ad720b56220f5be4"},
+		{81590, 46796, "ef6df312072ccefe965f07669b2819902f4e9889ebe7c35a38f1dc11ee99f212"},
+		{128386, 36543, "a816e22f4105741972eb34909b6f8ffa569759a1c2cf82ab88394b3db9019f23"},
+		{164929, 83172, "8b8e4a274f06dc3c92d49869a699a5a8255c0bf0b48a4d3c3689aaa3e9cff090"},
+		{248101, 76749, "583d08fc16d8d191af362a1aaecea6af062cc8afab1b301786bb717aa1b425b4"},
+		{324850, 79550, "aefa8c5a3c86896110565b6a3748c2f985892e8ab0073730cac390cb478a913a"},
+		{404400, 41484, "8e39f02975c8d0596e46f643b90cd290b7c0386845132eee4d415c63317773a4"},
+		{445884, 20326, "d689ca889f2f7ba26896681214f0f0f5f5177d5820d99b1f11ddb76b693bddee"},
+		{466210, 31652, "259de367c7ef2f51133d04e744f05918ceb93bd4b9c2bb6621ffeae70501dd09"},
+		{497862, 19995, "01ae987ec457cacc8b3528e3254bc9c93b3f0c0b2a51619e15be16e678ef016d"},
+		{517857, 103873, "78618b2d0539ecf45c08c7334e1c61051725767a76ba9108ad5298c6fd7cde1b"},
+		{621730, 38087, "f44e6992cccadb08d8e18174ba3d6dd6365bdfb9906a58a9f82621ace0461c0d"},
+		{659817, 38377, "abbf9935aaa535538c5fbff069481c343c2770207d88b94584314ee33050ae4f"},
+		{698194, 23449, "a6c737b95ab514d6538c6ef4c42ef2f08b201c3426a88b95e67e517510cd1fb9"},
+		{721643, 47321, "51d44e2d355d5c5b846543d47ba9569f12bbc3d49970c91913a8e3efef45e47e"},
+		{768964, 86692, "90f7e061ed2fb1ed9594297851f8528d3ac355c98457b5dce08ee7d88f801b26"},
+		{855656, 28268, "2dea144e5d771420e90b6e96c1e97e9c6afeda2c37ae7c95ceaf3ee2550efa08"},
+		{883924, 65465, "7a94e051c82ec7abba32883b2eee9a2832e8e9bcc3b3151743fef533e2d46e70"},
+		{949389, 33255, "32edd2d382045ad64d5fbd1a574f8191b700b9e0a2406bd90d2eefcf77168846"},
+		{982644, 65932, "a8bfdadaecbee1ed16ce23d8bf771d1b3fbca2e631fc71b5adb3846c1bb2d542"},
+	}
+
+	data, err := os.ReadFile("testdata/casync.input")
+	assert.NoError(t, err, "Test file should be readable")
+
+	var opts = SignatureOptions{Chunker: ChunkerCasync, MinChunk: 16 * 1024, MaxChunk: 256 * 1024, AvgChunk: 64 * 1024}
+	rc, err := opts.chunker()
+	assert.NoError(t, err, "chunker should not return error")
+
+	for _, jobs := range []int{1, 4} {
+		c := testChunker(rc.params)
+		c.jobs = jobs
+
+		var got []chunk
+		err = c.resolve(bytes.NewReader(data), func(c chunk, chunkData []byte) error {
+			digest := sha512.Sum512_256(chunkData)
+			c.hash = digest[:]
+			got = append(got, c)
+			return nil
+		})
+		assert.NoError(t, err, "resolve should not return error")
+		assert.Len(t, got, len(expected), "There should be as many chunks as casync finds")
+
+		for i := 0; i < len(got) && i < len(expected); i++ {
+			assert.Equal(t, expected[i].start, got[i].start, "Chunk %d should have casync's start", i)
+			assert.Equal(t, expected[i].size, got[i].size, "Chunk %d should have casync's size", i)
+			assert.Equal(t, expected[i].digest, hex.EncodeToString(got[i].hash), "Chunk %d should have casync's data", i)
+		}
+	}
+}
+
+func BenchmarkBuzhash(b *testing.B) {
+	var data = make([]byte, 1<<20)
+	var hashes = make([]uint64, 0, len(data))
+	rand.New(rand.NewSource(1)).Read(data)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		hashes = defaultBuzhashTable.calc(data, hashes[:0])
+	}
+}
@@ -0,0 +1,488 @@
+package datadiff
+
+import (
+	"container/heap"
+	"io"
+)
+
+const (
+	// bzip2BlockSize limits the run length encoded data of bzip2 block like bzip2 -9 does
+	bzip2BlockSize = 900000 - 19
+
+	// bzip2GroupSize is the number of symbols coded with the same Huffman table
+	bzip2GroupSize = 50
+
+	// bzip2MaxCodeLen limits the length of Huffman codes like bzip2 does
+	bzip2MaxCodeLen = 17
+
+	// bzip2Iterations is the number of times symbol groups are assigned to the best table and tables are rebuilt
+	bzip2Iterations = 4
+
+	bzip2BlockMagic = 0x314159265359
+	bzip2EndMagic   = 0x177245385090
+)
+
+// bzip2CRCTable is the table of big endian CRC-32 that bzip2 uses
+var bzip2CRCTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return
+}()
+
+// bzip2Writer compresses data to bzip2 stream, as standard library can only decompress it. Data is compressed in
+// blocks of the largest size with Burrows-Wheeler transform, move-to-front and Huffman coding like bzip2 -9 does.
+type bzip2Writer struct {
+	w   io.Writer
+	out bitWriter
+	err error
+
+	// Run length encoded data and CRC of current block
+	block []byte
+	crc   uint32
+
+	// Run of equal bytes which is not yet encoded
+	runByte byte
+	runLen  int
+
+	combinedCRC uint32
+}
+
+// newBzip2Writer creates bzip2Writer writing the stream to w
+func newBzip2Writer(w io.Writer) *bzip2Writer {
+	z := &bzip2Writer{w: w, crc: 0xffffffff}
+	z.out.buf = append(z.out.buf, "BZh9"...)
+	return z
+}
+
+// Write compresses p. Completed blocks are written to the underlying writer.
+func (z *bzip2Writer) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if z.runLen > 0 && (b != z.runByte || z.runLen == 255) {
+			z.writeRun()
+		}
+		z.runByte = b
+		z.runLen++
+	}
+
+	return len(p), z.err
+}
+
+// Close writes the last block and the end of stream. Underlying writer is not closed.
+func (z *bzip2Writer) Close() error {
+	if z.runLen > 0 {
+		z.writeRun()
+	}
+	z.writeBlock()
+
+	z.out.writeBits(24, bzip2EndMagic>>24)
+	z.out.writeBits(24, bzip2EndMagic&0xffffff)
+	z.out.writeBits(32, z.combinedCRC)
+	z.out.flush()
+	z.writeOut()
+
+	return z.err
+}
+
+// writeRun adds the current run to the block. Runs of four or more bytes are encoded as four bytes and the number
+// of remaining bytes.
+func (z *bzip2Writer) writeRun() {
+	if len(z.block)+5 > bzip2BlockSize {
+		z.writeBlock()
+	}
+
+	for i := 0; i < z.runLen; i++ {
+		z.crc = z.crc<<8 ^ bzip2CRCTable[byte(z.crc>>24)^z.runByte]
+	}
+
+	for i := 0; i < z.runLen && i < 4; i++ {
+		z.block = append(z.block, z.runByte)
+	}
+	if z.runLen >= 4 {
+		z.block = append(z.block, byte(z.runLen-4))
+	}
+
+	z.runLen = 0
+}
+
+// writeOut writes the complete bytes of compressed data to the underlying writer
+func (z *bzip2Writer) writeOut() {
+	if z.err == nil {
+		_, z.err = z.w.Write(z.out.buf)
+	}
+	z.out.buf = z.out.buf[:0]
+}
+
+// writeBlock compresses the current block
+func (z *bzip2Writer) writeBlock() {
+	if len(z.block) == 0 {
+		return
+	}
+
+	var crc = ^z.crc
+	z.combinedCRC = (z.combinedCRC<<1 | z.combinedCRC>>31) ^ crc
+
+	last, origPtr := bwt(z.block)
+
+	var inUse [256]bool
+	for _, b := range z.block {
+		inUse[b] = true
+	}
+	syms, alphaSize := bzip2MTF(last, &inUse)
+
+	z.out.writeBits(24, bzip2BlockMagic>>24)
+	z.out.writeBits(24, bzip2BlockMagic&0xffffff)
+	z.out.writeBits(32, crc)
+	z.out.writeBits(1, 0) // not randomized
+	z.out.writeBits(24, uint32(origPtr))
+
+	// Bitmap of 16 byte ranges which have used bytes, followed by bitmap of used bytes in each used range
+	var ranges uint32
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				ranges |= 1 << (15 - i)
+				break
+			}
+		}
+	}
+	z.out.writeBits(16, ranges)
+	for i := 0; i < 16; i++ {
+		if ranges&(1<<(15-i)) == 0 {
+			continue
+		}
+
+		var used uint32
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				used |= 1 << (15 - j)
+			}
+		}
+		z.out.writeBits(16, used)
+	}
+
+	z.writeHuffman(syms, alphaSize)
+	z.writeOut()
+
+	z.block = z.block[:0]
+	z.crc = 0xffffffff
+}
+
+// writeHuffman writes Huffman tables, selectors of table for each group of symbols and the coded symbols
+func (z *bzip2Writer) writeHuffman(syms []uint16, alphaSize int) {
+	var nGroups int
+	switch n := len(syms); {
+	case n < 200:
+		nGroups = 2
+	case n < 600:
+		nGroups = 3
+	case n < 1200:
+		nGroups = 4
+	case n < 2400:
+		nGroups = 5
+	default:
+		nGroups = 6
+	}
+
+	var freq = make([]int, alphaSize)
+	for _, s := range syms {
+		freq[s]++
+	}
+
+	// Each table initially codes a range of symbols with about equal share of symbols cheaply
+	var lengths = make([][]uint8, nGroups)
+	var remaining = len(syms)
+	var lo int
+	for t := 0; t < nGroups; t++ {
+		lengths[t] = make([]uint8, alphaSize)
+
+		target := remaining / (nGroups - t)
+		var hi, sum = lo, 0
+		for sum < target && hi < alphaSize {
+			sum += freq[hi]
+			hi++
+		}
+
+		for s := range lengths[t] {
+			if s < lo || s >= hi {
+				lengths[t][s] = 15
+			}
+		}
+		lo = hi
+		remaining -= sum
+	}
+
+	var selectors = make([]uint8, (len(syms)+bzip2GroupSize-1)/bzip2GroupSize)
+	for iter := 0; iter < bzip2Iterations; iter++ {
+		var tableFreq = make([][]int, nGroups)
+		for t := range tableFreq {
+			tableFreq[t] = make([]int, alphaSize)
+		}
+
+		for g := range selectors {
+			group := syms[g*bzip2GroupSize:]
+			if len(group) > bzip2GroupSize {
+				group = group[:bzip2GroupSize]
+			}
+
+			var best, bestCost = 0, -1
+			for t := 0; t < nGroups; t++ {
+				var cost int
+				for _, s := range group {
+					cost += int(lengths[t][s])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+
+			selectors[g] = uint8(best)
+			for _, s := range group {
+				tableFreq[best][s]++
+			}
+		}
+
+		for t := range lengths {
+			lengths[t] = huffmanCodeLengths(tableFreq[t], bzip2MaxCodeLen)
+		}
+	}
+
+	z.out.writeBits(3, uint32(nGroups))
+	z.out.writeBits(15, uint32(len(selectors)))
+
+	// Selectors are move-to-front coded in unary
+	var order = []uint8{0, 1, 2, 3, 4, 5}
+	for _, sel := range selectors {
+		var j int
+		for order[j] != sel {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = sel
+
+		for ; j > 0; j-- {
+			z.out.writeBits(1, 1)
+		}
+		z.out.writeBits(1, 0)
+	}
+
+	// Code lengths are deltas of the previous length
+	var codes = make([][]uint32, nGroups)
+	for t, lens := range lengths {
+		var cur = lens[0]
+		z.out.writeBits(5, uint32(cur))
+		for _, l := range lens {
+			for ; cur < l; cur++ {
+				z.out.writeBits(2, 2)
+			}
+			for ; cur > l; cur-- {
+				z.out.writeBits(2, 3)
+			}
+			z.out.writeBits(1, 0)
+		}
+
+		codes[t] = canonicalCodes(lens)
+	}
+
+	for i, s := range syms {
+		t := selectors[i/bzip2GroupSize]
+		z.out.writeBits(uint(lengths[t][s]), codes[t][s])
+	}
+}
+
+// bwt returns the last column of sorted rotations of data and the row of data itself. Rotations are sorted as the
+// suffixes of data repeated twice.
+func bwt(data []byte) (last []byte, origPtr int) {
+	var n = len(data)
+	var sa = suffixSort(append(append(make([]byte, 0, 2*n), data...), data...))
+
+	last = make([]byte, 0, n)
+	for _, p := range sa {
+		if int(p) >= n {
+			continue
+		}
+		if p == 0 {
+			origPtr = len(last)
+			last = append(last, data[n-1])
+		} else {
+			last = append(last, data[p-1])
+		}
+	}
+
+	return last, origPtr
+}
+
+// bzip2MTF returns move-to-front coded symbols of used bytes of data followed by end of block symbol. Runs of zeros
+// are coded as bijective base 2 numbers with RUNA and RUNB symbols, and other values are increased by one.
+func bzip2MTF(data []byte, inUse *[256]bool) (syms []uint16, alphaSize int) {
+	var order []byte
+	for b, used := range inUse {
+		if used {
+			order = append(order, byte(b))
+		}
+	}
+
+	const runA, runB = 0, 1
+	var zeros int
+	var writeZeros = func() {
+		for ; zeros > 0; zeros = (zeros - 1) / 2 {
+			if zeros&1 == 1 {
+				syms = append(syms, runA)
+			} else {
+				syms = append(syms, runB)
+				zeros--
+			}
+		}
+	}
+
+	syms = make([]uint16, 0, len(data)+1)
+	for _, b := range data {
+		if order[0] == b {
+			zeros++
+			continue
+		}
+		writeZeros()
+
+		var j = 1
+		for order[j] != b {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = b
+
+		syms = append(syms, uint16(j+1))
+	}
+	writeZeros()
+
+	alphaSize = len(order) + 2
+	syms = append(syms, uint16(alphaSize-1))
+	return syms, alphaSize
+}
+
+// huffmanNode is a node of Huffman tree while the tree is built
+type huffmanNode struct {
+	freq   int
+	depth  int
+	parent int
+}
+
+// huffmanHeap orders indexes of nodes by frequency and then by depth, which keeps trees shallow
+type huffmanHeap struct {
+	nodes []huffmanNode
+	items []int
+}
+
+func (h *huffmanHeap) Len() int { return len(h.items) }
+func (h *huffmanHeap) Less(i, j int) bool {
+	a, b := h.nodes[h.items[i]], h.nodes[h.items[j]]
+	return a.freq < b.freq || a.freq == b.freq && a.depth < b.depth
+}
+func (h *huffmanHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *huffmanHeap) Push(x any)    { h.items = append(h.items, x.(int)) }
+func (h *huffmanHeap) Pop() any {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+// huffmanCodeLengths returns Huffman code lengths of at most maxLen bits for all symbols of freq. Unused symbols get
+// a code too. Frequencies are halved until the longest code fits like bzip2 does.
+func huffmanCodeLengths(freq []int, maxLen int) []uint8 {
+	var lengths = make([]uint8, len(freq))
+	var weights = make([]int, len(freq))
+	for i, f := range freq {
+		weights[i] = f
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+	}
+
+	for {
+		h := &huffmanHeap{}
+		for i, w := range weights {
+			h.nodes = append(h.nodes, huffmanNode{freq: w, parent: -1})
+			h.items = append(h.items, i)
+		}
+		heap.Init(h)
+
+		for h.Len() > 1 {
+			a := heap.Pop(h).(int)
+			b := heap.Pop(h).(int)
+
+			depth := h.nodes[a].depth
+			if h.nodes[b].depth > depth {
+				depth = h.nodes[b].depth
+			}
+			h.nodes = append(h.nodes, huffmanNode{freq: h.nodes[a].freq + h.nodes[b].freq, depth: depth + 1, parent: -1})
+			h.nodes[a].parent = len(h.nodes) - 1
+			h.nodes[b].parent = len(h.nodes) - 1
+			heap.Push(h, len(h.nodes)-1)
+		}
+
+		var tooLong bool
+		for i := range lengths {
+			var l int
+			for p := h.nodes[i].parent; p >= 0; p = h.nodes[p].parent {
+				l++
+			}
+			lengths[i] = uint8(l)
+			tooLong = tooLong || l > maxLen
+		}
+		if !tooLong {
+			return lengths
+		}
+
+		for i := range weights {
+			weights[i] = 1 + weights[i]/2
+		}
+	}
+}
+
+// canonicalCodes assigns codes to symbols in order of code length and symbol like bzip2 does
+func canonicalCodes(lengths []uint8) []uint32 {
+	var codes = make([]uint32, len(lengths))
+	var code uint32
+	for l := uint8(1); l <= 32; l++ {
+		for s, sl := range lengths {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+
+	return codes
+}
+
+// bitWriter collects bits most significant bit first
+type bitWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+// writeBits writes the lowest n bits of v, n is at most 32
+func (b *bitWriter) writeBits(n uint, v uint32) {
+	b.bits = b.bits<<n | uint64(v)&(1<<n-1)
+	b.n += n
+	for b.n >= 8 {
+		b.n -= 8
+		b.buf = append(b.buf, byte(b.bits>>b.n))
+	}
+}
+
+// flush pads the last byte with zero bits
+func (b *bitWriter) flush() {
+	if b.n > 0 {
+		b.writeBits(8-b.n, 0)
+	}
+}
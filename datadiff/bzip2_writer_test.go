@@ -0,0 +1,109 @@
+package datadiff
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBzip2Writer(t *testing.T) {
+	var rnd = rand.New(rand.NewSource(15))
+
+	var random = make([]byte, 100000)
+	rnd.Read(random)
+
+	// Text like data of several blocks with runs of all lengths
+	var text bytes.Buffer
+	for text.Len() < 2*bzip2BlockSize {
+		text.WriteString(strings.Repeat(string(rune('a'+rnd.Intn(26))), 1+rnd.Intn(300)))
+		text.WriteString("Some words of text. ")
+	}
+
+	var tests = []struct {
+		name        string
+		data        []byte
+		expectedMax int
+	}{
+		{name: "Empty", data: []byte{}, expectedMax: 14},
+		{name: "Single byte", data: []byte("x"), expectedMax: 50},
+		{name: "Short text", data: []byte("Hello, hello, hello world!"), expectedMax: 100},
+		{name: "Random", data: random, expectedMax: 101000},
+		{name: "Zeros", data: make([]byte, 3*bzip2BlockSize), expectedMax: 200},
+		{name: "Text", data: text.Bytes(), expectedMax: text.Len() / 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			z := newBzip2Writer(buf)
+
+			// Data is written in pieces which split runs
+			for data := tt.data; len(data) > 0; {
+				n := 1 + rnd.Intn(10000)
+				if n > len(data) {
+					n = len(data)
+				}
+				_, err := z.Write(data[:n])
+				assert.NoError(t, err, "Write should not return error")
+				data = data[n:]
+			}
+			assert.NoError(t, z.Close(), "Close should not return error")
+			assert.LessOrEqual(t, buf.Len(), tt.expectedMax, "Data should be compressed")
+
+			got, err := io.ReadAll(bzip2.NewReader(buf))
+			assert.NoError(t, err, "Stream should be decompressed")
+			assert.True(t, bytes.Equal(tt.data, got), "Decompressed data should equal to compressed data")
+		})
+	}
+}
+
+func TestHuffmanCodeLengths(t *testing.T) {
+	// Fibonacci frequencies make the deepest tree
+	var freq = make([]int, 30)
+	freq[0], freq[1] = 1, 1
+	for i := 2; i < len(freq); i++ {
+		freq[i] = freq[i-1] + freq[i-2]
+	}
+
+	for _, maxLen := range []int{bzip2MaxCodeLen, 32} {
+		lengths := huffmanCodeLengths(freq, maxLen)
+
+		var kraft float64
+		var longest uint8
+		for _, l := range lengths {
+			kraft += 1 / float64(uint64(1)<<l)
+			if l > longest {
+				longest = l
+			}
+		}
+		assert.Equal(t, 1.0, kraft, "Code should be complete")
+		assert.LessOrEqual(t, int(longest), maxLen, "Longest code should be limited to %d bits", maxLen)
+		assert.Greater(t, int(longest), bzip2MaxCodeLen-4, "Frequencies should not be halved more than needed")
+	}
+
+	assert.Equal(t, []uint8{1, 2, 2}, huffmanCodeLengths([]int{10, 0, 3}, bzip2MaxCodeLen),
+		"Unused symbols should have a code")
+	assert.Equal(t, []uint32{0, 2, 3}, canonicalCodes([]uint8{1, 2, 2}), "Codes should be canonical")
+}
+
+func BenchmarkBzip2Writer(b *testing.B) {
+	var data = make([]byte, 1<<20)
+	var rnd = rand.New(rand.NewSource(1))
+	for i := range data {
+		data[i] = byte(rnd.Intn(16))
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		z := newBzip2Writer(io.Discard)
+		z.Write(data)
+		z.Close()
+	}
+}
@@ -0,0 +1,125 @@
+package datadiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Checksum trailer follows the end of chunks in data-diff signature and the END command in delta. It consists of
+// checksumMagic, hash id, flags of included checksums and the checksums of whole basis and new file. Strict rdiff
+// files have no trailer.
+const (
+	checksumMagic = "DDCK"
+
+	// Flags of checksums in trailer
+	checksumBasis   = uint8(1)
+	checksumNewFile = uint8(2)
+)
+
+// ErrChecksumMismatch is matched by errors of basis or patched file which differs from its recorded checksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// fileChecksums are whole file checksums recorded in signature or delta. Nil checksum is not known.
+type fileChecksums struct {
+	basis   []byte
+	newFile []byte
+}
+
+// newFileHash creates hash of whole file checksums. Algorithm is fixed, so patch can hash its output before the
+// trailer is read.
+func newFileHash() hash.Hash {
+	// Error is returned only for too long key
+	h, _ := blake2b.New256(nil)
+	return h
+}
+
+// writeChecksums writes checksum trailer of c to w
+func writeChecksums(w io.Writer, c fileChecksums) error {
+	var flags uint8
+	if c.basis != nil {
+		flags |= checksumBasis
+	}
+	if c.newFile != nil {
+		flags |= checksumNewFile
+	}
+
+	var b = append([]byte(checksumMagic), hashBLAKE2b, flags)
+	b = append(b, c.basis...)
+	b = append(b, c.newFile...)
+
+	_, err := w.Write(b)
+	return err
+}
+
+// readChecksums reads checksum trailer from r. Input that ends where trailer would start has no checksums.
+func readChecksums(r io.Reader) (c fileChecksums, err error) {
+	var b [len(checksumMagic)]byte
+
+	_, err = io.ReadFull(r, b[:])
+	if err == io.EOF {
+		return c, nil
+	}
+	if err == io.ErrUnexpectedEOF || err == nil && string(b[:]) != checksumMagic {
+		return c, fmt.Errorf("unexpected data after end of file")
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read checksums: %s", err.Error())
+	}
+
+	_, err = io.ReadFull(r, b[:2])
+	if err != nil {
+		return c, fmt.Errorf("failed to read checksums: %s", noEOF(err).Error())
+	}
+
+	if id := b[0]; id != hashBLAKE2b {
+		return c, fmt.Errorf("unknown checksum hash: %d", id)
+	}
+
+	var flags = b[1]
+	if flags&^(checksumBasis|checksumNewFile) != 0 {
+		return c, fmt.Errorf("unknown checksum flags: 0x%02x", flags)
+	}
+
+	for _, f := range []struct {
+		flag uint8
+		sum  *[]byte
+	}{
+		{checksumBasis, &c.basis},
+		{checksumNewFile, &c.newFile},
+	} {
+		if flags&f.flag == 0 {
+			continue
+		}
+
+		*f.sum = make([]byte, blake2b.Size256)
+		_, err = io.ReadFull(r, *f.sum)
+		if err != nil {
+			return c, fmt.Errorf("failed to read checksums: %s", noEOF(err).Error())
+		}
+	}
+
+	return c, nil
+}
+
+// verifyChecksum returns ErrChecksumMismatch error if h does not match the expected checksum of file argName
+func verifyChecksum(argName string, expected []byte, h hash.Hash) error {
+	if expected == nil || bytes.Equal(expected, h.Sum(nil)) {
+		return nil
+	}
+
+	return fmt.Errorf("%s file does not match checksum of delta: %w", argName, ErrChecksumMismatch)
+}
+
+// noEOF converts EOF to ErrUnexpectedEOF for reads that have to succeed
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
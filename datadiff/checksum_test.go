@@ -0,0 +1,222 @@
+package datadiff
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestChecksumsReadWrite(t *testing.T) {
+	var basis, newFile = blake2b.Sum256([]byte("basis")), blake2b.Sum256([]byte("new file"))
+
+	for _, c := range []fileChecksums{
+		{basis: basis[:]},
+		{newFile: newFile[:]},
+		{basis: basis[:], newFile: newFile[:]},
+	} {
+		buf := &bytes.Buffer{}
+		err := writeChecksums(buf, c)
+		assert.NoError(t, err, "writeChecksums should not return error")
+
+		got, err := readChecksums(buf)
+		assert.NoError(t, err, "readChecksums should not return error")
+		assert.Equal(t, c, got, "Read checksums should equal to written ones")
+		assert.Zero(t, buf.Len(), "Checksums should be read completely")
+	}
+}
+
+func TestReadChecksumsErrors(t *testing.T) {
+	var tests = []struct {
+		name        string
+		data        string
+		expectedErr string
+	}{
+		{
+			name: "No trailer",
+		},
+		{
+			name:        "Unexpected data",
+			data:        "garbage",
+			expectedErr: "unexpected data after end of file",
+		},
+		{
+			name:        "Truncated header",
+			data:        checksumMagic + "\x03",
+			expectedErr: "failed to read checksums: unexpected EOF",
+		},
+		{
+			name:        "Unknown hash",
+			data:        checksumMagic + "\x01\x02",
+			expectedErr: "unknown checksum hash: 1",
+		},
+		{
+			name:        "Unknown flags",
+			data:        checksumMagic + "\x03\x04",
+			expectedErr: "unknown checksum flags: 0x04",
+		},
+		{
+			name:        "Truncated checksum",
+			data:        checksumMagic + "\x03\x02" + strings.Repeat("\x00", 31),
+			expectedErr: "failed to read checksums: unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := readChecksums(strings.NewReader(tt.data))
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "readChecksums should not return error")
+			assert.Equal(t, fileChecksums{}, c, "There should be no checksums")
+		})
+	}
+}
+
+func TestSignatureChecksum(t *testing.T) {
+	var basis = make([]byte, 3000)
+	rand.New(rand.NewSource(5)).Read(basis)
+
+	for _, jobs := range []int{1, 4} {
+		sig := &bytes.Buffer{}
+		err := Signature(bytes.NewReader(basis), sig, SignatureOptions{Jobs: jobs})
+		assert.NoError(t, err, "Signature should not return error")
+
+		h, _, err := readSignature(bytes.NewReader(sig.Bytes()), int64(sig.Len()))
+		assert.NoError(t, err, "readSignature should not return error")
+
+		expected := blake2b.Sum256(basis)
+		assert.Equal(t, expected[:], h.checksum, "Signature should have checksum of basis with %d jobs", jobs)
+	}
+}
+
+func TestPatchVerifiesChecksums(t *testing.T) {
+	var basis = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(6)).Read(basis)
+
+	var modified = append([]byte("Prefix"), basis...)
+
+	var otherBasis = append([]byte(nil), basis...)
+	otherBasis[len(otherBasis)-1]++
+
+	sig := &bytes.Buffer{}
+	err := Signature(bytes.NewReader(basis), sig, SignatureOptions{})
+	assert.NoError(t, err, "Signature should not return error")
+
+	delta := &bytes.Buffer{}
+	err = Delta(bytes.NewReader(sig.Bytes()), bytes.NewReader(modified), delta, DeltaOptions{})
+	assert.NoError(t, err, "Delta should not return error")
+
+	strict := &bytes.Buffer{}
+	err = Delta(bytes.NewReader(sig.Bytes()), bytes.NewReader(modified), strict, DeltaOptions{Format: FormatRdiff})
+	assert.NoError(t, err, "Delta should not return error")
+	assert.Equal(t, byte(RS_OP_END), strict.Bytes()[strict.Len()-1], "Rdiff delta should end to END command")
+
+	// Literal "Prefix" is right after the magic and the command
+	var corrupt = append([]byte(nil), delta.Bytes()...)
+	corrupt[len(RS_DELTA_MAGIC)+1] = 'p'
+
+	var tests = []struct {
+		name        string
+		basis       []byte
+		delta       []byte
+		expectedErr string
+	}{
+		{
+			name:  "Verified delta",
+			basis: basis,
+			delta: delta.Bytes(),
+		},
+		{
+			name:        "Different basis",
+			basis:       otherBasis,
+			delta:       delta.Bytes(),
+			expectedErr: "BASIS file does not match checksum of delta: checksum mismatch",
+		},
+		{
+			name:        "Corrupted literal",
+			basis:       basis,
+			delta:       corrupt,
+			expectedErr: "NEWFILE file does not match checksum of delta: checksum mismatch",
+		},
+		{
+			name:  "Strict rdiff delta is not verified",
+			basis: otherBasis,
+			delta: strict.Bytes(),
+		},
+		{
+			name:        "Data after END command",
+			basis:       basis,
+			delta:       append(append([]byte(nil), strict.Bytes()...), 'x'),
+			expectedErr: "invalid DELTA file: unexpected data after end of file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Patch(bytes.NewReader(tt.basis), bytes.NewReader(tt.delta), &bytes.Buffer{}, PatchOptions{})
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "Patch should not return error")
+		})
+	}
+
+	err = Patch(bytes.NewReader(otherBasis), bytes.NewReader(delta.Bytes()), &bytes.Buffer{}, PatchOptions{})
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "Error should match ErrChecksumMismatch")
+}
+
+func TestDeltaFormat(t *testing.T) {
+	var basis = []byte(strings.Repeat("Some basis data. ", 100))
+
+	for _, tt := range []struct {
+		name             string
+		sigFormat        string
+		deltaFormat      string
+		expectedTrailer  bool
+		expectedChecksum bool
+	}{
+		{name: "Data-diff signature", expectedTrailer: true, expectedChecksum: true},
+		{name: "Data-diff signature with rdiff delta", deltaFormat: FormatRdiff},
+		{name: "Rdiff signature", sigFormat: FormatRdiff},
+		{name: "Rdiff signature with data-diff delta", sigFormat: FormatRdiff, deltaFormat: FormatDataDiff,
+			expectedTrailer: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := &bytes.Buffer{}
+			err := Signature(bytes.NewReader(basis), sig, SignatureOptions{Format: tt.sigFormat})
+			assert.NoError(t, err, "Signature should not return error")
+
+			delta := &bytes.Buffer{}
+			err = Delta(sig, bytes.NewReader(basis), delta, DeltaOptions{Format: tt.deltaFormat})
+			assert.NoError(t, err, "Delta should not return error")
+
+			i := bytes.Index(delta.Bytes(), []byte(checksumMagic))
+			if !tt.expectedTrailer {
+				assert.Equal(t, -1, i, "Delta should not have checksums")
+				return
+			}
+
+			c, err := readChecksums(bytes.NewReader(delta.Bytes()[i:]))
+			assert.NoError(t, err, "readChecksums should not return error")
+
+			expected := blake2b.Sum256(basis)
+			assert.Equal(t, expected[:], c.newFile, "Delta should have checksum of new file")
+			assert.Equal(t, tt.expectedChecksum, c.basis != nil, "Delta should have checksum of basis from signature")
+		})
+	}
+
+	err := Delta(strings.NewReader(""), strings.NewReader(""), &bytes.Buffer{}, DeltaOptions{Format: "zip"})
+	assert.EqualError(t, err, "unsupported delta format: zip")
+}
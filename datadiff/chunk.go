@@ -0,0 +1,501 @@
+package datadiff
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+const (
+	// Default chunk parameters
+	chunkSeparator = 0x007f
+	chunkMinSize   = 32
+	chunkMaxSize   = 1024
+
+	// chunkSizeLimit is the largest allowed maximum chunk size
+	chunkSizeLimit = 64 * 1024 * 1024
+
+	// chunkReadSize is the size of blocks in which data is read when resolving chunks
+	chunkReadSize = 64 * 1024
+)
+
+// Chunking algorithm identifiers stored in signatureHeader
+const (
+	chunkerPolynomial = uint8(0)
+	chunkerFastCDC    = uint8(1)
+	chunkerRabin      = uint8(2)
+	chunkerBuzhash    = uint8(3)
+	chunkerCasync     = uint8(4)
+)
+
+// Conditions of rolling hash at chunk boundary
+const (
+	// boundarySeparator chunk ends where all separator bits of hash are set
+	boundarySeparator = iota
+
+	// boundaryNormalized chunk ends where the high bits of hash are zero like in FastCDC normalized chunking. More bits
+	// are required before the average size than after it.
+	boundaryNormalized
+
+	// boundaryZero chunk ends where all separator bits of hash are zero like in restic
+	boundaryZero
+
+	// boundaryModulo chunk ends where hash modulo the discriminator of average size is discriminator-1 like in casync
+	boundaryModulo
+)
+
+// rollingHashFunc calculates hash of each window of data and appends them to hashes like calcRollingHash
+type rollingHashFunc func(data []byte, hashes []uint64) []uint64
+
+// chunkAlgorithm is an algorithm that finds chunk boundaries with rolling hash
+type chunkAlgorithm struct {
+	id       uint8
+	name     string
+	window   int
+	boundary int
+
+	// reset restarts rolling hash at each chunk like restic and casync do, so the window of a boundary never reaches
+	// the previous chunk and data before the first possible boundary is not hashed. Otherwise hash rolls over chunks.
+	reset bool
+
+	// skip is how many bytes after minimum chunk size the first possible boundary of reset algorithm is
+	skip int
+
+	// separatorBits is the largest number of separator bits that hashes of rollingHash can match. It limits average
+	// chunk size: polynomial hash is smaller than pM, normalized chunking matches two bits more of 64 bit gear hash,
+	// buzhash and Rabin fingerprint of polynomial of the smallest degree have 32 bits, and the discriminator of casync
+	// is positive only up to 8 MiB average.
+	separatorBits int
+
+	// rollingHash returns rolling hash with parameters of p or error if they are not valid
+	rollingHash func(p chunkParams) (rollingHashFunc, error)
+}
+
+// chunkAlgorithms contains the supported chunking algorithms
+var chunkAlgorithms = []chunkAlgorithm{
+	{
+		id:            chunkerPolynomial,
+		name:          ChunkerPolynomial,
+		window:        windowSize,
+		boundary:      boundarySeparator,
+		separatorBits: 28,
+		rollingHash:   fixedRollingHash(calcRollingHash),
+	},
+	{
+		id:            chunkerFastCDC,
+		name:          ChunkerFastCDC,
+		window:        gearWindowSize,
+		boundary:      boundaryNormalized,
+		separatorBits: 62,
+		rollingHash:   fixedRollingHash(calcGearHash),
+	},
+	{
+		id:            chunkerRabin,
+		name:          ChunkerRabin,
+		window:        rabinWindowSize,
+		boundary:      boundaryZero,
+		reset:         true,
+		separatorBits: 32,
+		rollingHash: func(p chunkParams) (rollingHashFunc, error) {
+			rh, err := newRabinHash(p.polynomial)
+			if err != nil {
+				return nil, err
+			}
+
+			return rh.calc, nil
+		},
+	},
+	{
+		id:            chunkerBuzhash,
+		name:          ChunkerBuzhash,
+		window:        buzhashWindowSize,
+		boundary:      boundaryZero,
+		reset:         true,
+		separatorBits: 32,
+		rollingHash: func(p chunkParams) (rollingHashFunc, error) {
+			if p.table == nil {
+				return nil, fmt.Errorf("buzhash chunker has no table")
+			}
+
+			return p.table.calc, nil
+		},
+	},
+	{
+		id:            chunkerCasync,
+		name:          ChunkerCasync,
+		window:        buzhashWindowSize,
+		boundary:      boundaryModulo,
+		reset:         true,
+		skip:          1,
+		separatorBits: 23,
+		rollingHash:   fixedRollingHash(casyncBuzhashTable.calc),
+	},
+}
+
+// fixedRollingHash returns rollingHash of chunkAlgorithm which has no parameters
+func fixedRollingHash(f rollingHashFunc) func(p chunkParams) (rollingHashFunc, error) {
+	return func(chunkParams) (rollingHashFunc, error) {
+		return f, nil
+	}
+}
+
+// chunkAlgorithmByName returns id of chunking algorithm with name
+func chunkAlgorithmByName(name string) (uint8, error) {
+	var names []string
+	for _, a := range chunkAlgorithms {
+		if a.name == strings.ToLower(name) {
+			return a.id, nil
+		}
+		names = append(names, a.name)
+	}
+
+	return 0, fmt.Errorf("unknown chunker: %s (supported: %s)", name, strings.Join(names, ", "))
+}
+
+// chunkParams controls how data is split to chunks
+type chunkParams struct {
+	// algorithm is the id of chunkAlgorithm
+	algorithm uint8
+
+	// Chunk sizes in bytes
+	minSize int
+	maxSize int
+
+	// Chunk ends where all separator bits of rolling hash are set, or zero depending on algorithm. Average chunk size
+	// is separator+1.
+	separator uint64
+
+	// Parameters of rolling hash: polynomial of rabin and byte table of buzhash
+	polynomial uint64
+	table      *buzhashTable
+}
+
+var defaultChunkParams = chunkParams{
+	algorithm: chunkerPolynomial,
+	minSize:   chunkMinSize,
+	maxSize:   chunkMaxSize,
+	separator: chunkSeparator,
+}
+
+// newChunkParams creates chunkParams of algorithm from chunk sizes. Average size has to be power of two as it
+// determines the separator bits.
+func newChunkParams(algorithm uint8, minSize, maxSize, avgSize int) (chunkParams, error) {
+	if avgSize < 2 || avgSize&(avgSize-1) != 0 {
+		return chunkParams{}, fmt.Errorf("average chunk size has to be power of two: %d", avgSize)
+	}
+
+	p := chunkParams{
+		algorithm: algorithm,
+		minSize:   minSize,
+		maxSize:   maxSize,
+		separator: uint64(avgSize - 1),
+	}
+
+	return p, p.validate()
+}
+
+// chunkAlgorithm returns the algorithm of p or error if it is not supported
+func (p chunkParams) chunkAlgorithm() (chunkAlgorithm, error) {
+	for _, a := range chunkAlgorithms {
+		if a.id == p.algorithm {
+			return a, nil
+		}
+	}
+
+	return chunkAlgorithm{}, fmt.Errorf("unknown chunker: %d", p.algorithm)
+}
+
+// validate checks that chunk sizes are usable
+func (p chunkParams) validate() error {
+	if p.minSize < 1 {
+		return fmt.Errorf("minimum chunk size has to be positive: %d", p.minSize)
+	}
+	if p.maxSize < p.minSize {
+		return fmt.Errorf("maximum chunk size %d is smaller than minimum chunk size %d", p.maxSize, p.minSize)
+	}
+	if p.maxSize > chunkSizeLimit {
+		return fmt.Errorf("maximum chunk size %d exceeds limit %d", p.maxSize, chunkSizeLimit)
+	}
+
+	a, err := p.chunkAlgorithm()
+	if err != nil {
+		return err
+	}
+
+	// The first boundary of a file, and every boundary of reset algorithms, needs a whole window of the chunk
+	if p.maxSize < a.window {
+		return fmt.Errorf("maximum chunk size %d is smaller than %d byte window of %s chunker", p.maxSize, a.window,
+			a.name)
+	}
+	if bits.Len64(p.separator) > a.separatorBits {
+		return fmt.Errorf("average chunk size %d is too large for %s chunker", p.separator+1, a.name)
+	}
+
+	return nil
+}
+
+type chunk struct {
+	start        uint64
+	size         uint64
+	stopChecksum uint64
+
+	hash []byte
+
+	// For diff processing
+	number int
+}
+
+// chunker resolves chunks with the state of one operation, so it must not be used concurrently
+type chunker struct {
+	params     chunkParams
+	hashParams hashParams
+	hasher     *chunkHasher
+	log        *logger
+
+	// jobs is the number of goroutines that calculate strong hashes of chunks
+	jobs int
+
+	// rollingHash calculates rolling hashes of data windows, rollingHash of algorithm unless replaced in tests
+	rollingHash rollingHashFunc
+	window      int
+	boundary    int
+	reset       bool
+
+	// first is the smallest chunk size that can end at a boundary of reset algorithm
+	first int
+
+	// Masks of normalized chunking before and after the average size
+	maskS, maskL uint64
+
+	// discriminator divides hash at modulo boundary
+	discriminator uint64
+}
+
+// newChunker creates chunker that resolves chunks with p and hashes them with hp in jobs goroutines
+func newChunker(p chunkParams, hp hashParams, jobs int, log *logger) (*chunker, error) {
+	a, err := p.chunkAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	rollingHash, err := a.rollingHash(p)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := hp.newHasher()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &chunker{
+		params:      p,
+		hashParams:  hp,
+		hasher:      hasher,
+		log:         log,
+		jobs:        jobs,
+		rollingHash: rollingHash,
+		window:      a.window,
+		boundary:    a.boundary,
+		reset:       a.reset,
+	}
+
+	if a.reset {
+		c.first = p.minSize + a.skip
+		if c.first < a.window {
+			c.first = a.window
+		}
+		if c.first > p.maxSize {
+			c.first = p.maxSize
+		}
+	}
+
+	switch a.boundary {
+	case boundaryNormalized:
+		// Normalization level 2 of FastCDC: two more bits before and two less bits after the average size
+		n := bits.Len64(p.separator)
+		c.maskS = highBits(n + 2)
+		c.maskL = highBits(n - 2)
+	case boundaryModulo:
+		c.discriminator = casyncDiscriminator(p.separator + 1)
+	}
+
+	return c, nil
+}
+
+// highBits returns uint64 with n highest bits set. N is limited between 1 and 64.
+func highBits(n int) uint64 {
+	if n < 1 {
+		n = 1
+	}
+	if n > 64 {
+		n = 64
+	}
+
+	return ^uint64(0) << (64 - n)
+}
+
+// isBoundary tells whether chunk of size bytes ends at window with hash
+func (c *chunker) isBoundary(hash uint64, size int) bool {
+	if size < c.params.minSize {
+		return false
+	}
+	if size >= c.params.maxSize {
+		return true
+	}
+
+	switch c.boundary {
+	case boundaryNormalized:
+		if uint64(size) <= c.params.separator {
+			return hash&c.maskS == 0
+		}
+		return hash&c.maskL == 0
+	case boundaryZero:
+		return hash&c.params.separator == 0
+	case boundaryModulo:
+		return hash%c.discriminator == c.discriminator-1
+	}
+
+	return hash|c.params.separator == hash
+}
+
+// newChunk creates chunk of data which starts from start offset of the file
+func (c *chunker) newChunk(data []byte, start, hash uint64) chunk {
+	ch := chunk{
+		start:        start,
+		size:         uint64(len(data)),
+		stopChecksum: hash,
+		hash:         c.hasher.sum(data),
+	}
+	c.logChunk(ch, data)
+
+	return ch
+}
+
+// logChunk traces hashes and data of chunk
+func (c *chunker) logChunk(ch chunk, data []byte) {
+	if c.log.enabled() {
+		c.log.println(base64.StdEncoding.EncodeToString(ch.hash))
+		c.log.println(ch.stopChecksum, len(data), ":", "\""+string(data)+"\"")
+	}
+}
+
+// resolve reads data from r and calls fn for each resolved chunk with the chunk's data. Data slice is valid only
+// until fn returns. Data is read in blocks so only the unfinished chunk and one block is kept in memory.
+func (c *chunker) resolve(r io.Reader, fn func(c chunk, data []byte) error) error {
+	if c.jobs > 1 {
+		return c.resolveParallel(r, fn)
+	}
+
+	return c.findBoundaries(r, func(data []byte, start, hash uint64) error {
+		err := fn(c.newChunk(data, start, hash), data)
+		c.log.println()
+
+		return err
+	})
+}
+
+// nextWindow returns the end of the first window in buf that can be a boundary of chunk starting at start
+func (c *chunker) nextWindow(start int) int {
+	if c.reset {
+		return start + c.first - 1
+	}
+
+	return start
+}
+
+// lastWindowHash returns rolling hash of the last window of data, or zero if data is shorter than window
+func (c *chunker) lastWindowHash(data []byte) uint64 {
+	if len(data) < c.window {
+		return 0
+	}
+
+	return c.rollingHash(data[len(data)-c.window:], nil)[0]
+}
+
+// findBoundaries reads data from r and calls boundary for the data of each chunk with chunk's file offset and the
+// rolling hash at the end of chunk. Data slice is valid only until boundary returns.
+func (c *chunker) findBoundaries(r io.Reader, boundary func(data []byte, start, hash uint64) error) error {
+	var p = c.params
+
+	// buf holds data of unfinished chunk and window-1 bytes preceding the next window
+	var buf = make([]byte, 0, p.maxSize+chunkReadSize)
+	var hashes = make([]uint64, 0, cap(buf))
+	var offset uint64 // File offset of buf[0]
+	var prevIndex int // Start of unfinished chunk in buf
+	var next int      // End of the next window to check in buf
+	var hash uint64
+	var err error
+
+	// The first window of file ends at its window-th byte
+	next = c.nextWindow(0)
+	if next < c.window-1 {
+		next = c.window - 1
+	}
+
+	for {
+		keep := next - (c.window - 1)
+		if prevIndex < keep {
+			keep = prevIndex
+		}
+		if keep > 0 {
+			buf = buf[:copy(buf, buf[keep:])]
+			offset += uint64(keep)
+			prevIndex -= keep
+			next -= keep
+		}
+
+		var n int
+		n, err = io.ReadFull(r, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+			if n == 0 {
+				break
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if next < len(buf) {
+			// Hashes of windows ending at each byte from next on. Hash of window depends only on its data, so hashes
+			// after a boundary are valid also for reset algorithms once their windows are in the new chunk.
+			var from = next
+			hashes = c.rollingHash(buf[from-(c.window-1):], hashes[:0])
+			hash = hashes[len(hashes)-1]
+
+			for next < len(buf) {
+				if !c.isBoundary(hashes[next-from], next-prevIndex+1) {
+					next++
+					continue
+				}
+
+				// Hash passes chunk separator criterias so mark new chunk
+				err = boundary(buf[prevIndex:next+1], offset+uint64(prevIndex), hashes[next-from])
+				if err != nil {
+					return err
+				}
+
+				prevIndex = next + 1
+				next = c.nextWindow(prevIndex)
+			}
+		}
+
+		if len(buf) < cap(buf) {
+			// Reached end of file
+			break
+		}
+	}
+
+	if prevIndex < len(buf) {
+		// Write last chunk if the last hash was not naturally a chunk separator
+		if c.reset {
+			hash = c.lastWindowHash(buf[prevIndex:])
+		}
+		err = boundary(buf[prevIndex:], offset+uint64(prevIndex), hash)
+	}
+
+	return err
+}
@@ -0,0 +1,120 @@
+package datadiff
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// errResolveStopped is returned by boundary callback when chunks are no longer consumed
+var errResolveStopped = errors.New("resolving chunks stopped")
+
+// hashBatch contains consecutive chunks whose strong hashes are calculated by a worker
+type hashBatch struct {
+	// data of chunks, which is copied as read buffer is reused
+	data   []byte
+	chunks []chunk
+
+	// done is closed when hashes of chunks are calculated
+	done chan struct{}
+}
+
+// resolveParallel resolves chunks like resolve, but calculates strong hashes of chunks in c.jobs goroutines. Boundaries
+// are found in one goroutine and fn is called in the calling goroutine in the order of chunks, so the result does not
+// depend on the number of jobs.
+func (c *chunker) resolveParallel(r io.Reader, fn func(c chunk, data []byte) error) error {
+	// Workers pick batches from work and the batches are consumed in order from ordered
+	var work = make(chan *hashBatch, c.jobs)
+	var ordered = make(chan *hashBatch, 2*c.jobs)
+	var quit = make(chan struct{})
+	var workers sync.WaitGroup
+
+	for j := 0; j < c.jobs; j++ {
+		// Hash params are validated by newChunker
+		hasher, _ := c.hashParams.newHasher()
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			for batch := range work {
+				var offset uint64
+				for i := range batch.chunks {
+					batch.chunks[i].hash = hasher.sum(batch.data[offset : offset+batch.chunks[i].size])
+					offset += batch.chunks[i].size
+				}
+				close(batch.done)
+			}
+		}()
+	}
+
+	var readErr error
+	go func() {
+		defer close(ordered)
+		defer close(work)
+
+		var batch = &hashBatch{done: make(chan struct{})}
+		send := func() error {
+			for _, ch := range []chan *hashBatch{work, ordered} {
+				select {
+				case ch <- batch:
+				case <-quit:
+					return errResolveStopped
+				}
+			}
+
+			batch = &hashBatch{done: make(chan struct{})}
+			return nil
+		}
+
+		readErr = c.findBoundaries(r, func(data []byte, start, hash uint64) error {
+			batch.chunks = append(batch.chunks, chunk{
+				start:        start,
+				size:         uint64(len(data)),
+				stopChecksum: hash,
+			})
+			batch.data = append(batch.data, data...)
+
+			if len(batch.data) >= chunkReadSize {
+				return send()
+			}
+			return nil
+		})
+		if readErr == nil && len(batch.chunks) > 0 {
+			readErr = send()
+		}
+	}()
+
+	var err error
+	for batch := range ordered {
+		if err != nil {
+			// Drain batches until boundary search has stopped
+			continue
+		}
+
+		<-batch.done
+
+		var offset uint64
+		for _, ch := range batch.chunks {
+			data := batch.data[offset : offset+ch.size]
+			offset += ch.size
+
+			c.logChunk(ch, data)
+			err = fn(ch, data)
+			c.log.println()
+
+			if err != nil {
+				close(quit)
+				break
+			}
+		}
+	}
+
+	workers.Wait()
+
+	if err != nil {
+		return err
+	}
+
+	return readErr
+}
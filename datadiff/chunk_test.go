@@ -0,0 +1,552 @@
+package datadiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testChunker creates chunker with p and default strong hash
+func testChunker(p chunkParams) *chunker {
+	c, err := newChunker(p, defaultHashParams, 1, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+func createData(l int, b byte) []byte {
+	var d = make([]byte, l)
+
+	for i := 0; i < len(d); i++ {
+		d[i] = b
+	}
+
+	return d
+}
+
+func TestResolveChunks(t *testing.T) {
+	var tests = []struct {
+		name           string
+		data           []byte
+		rollingFunc    func(data []byte, hashes []uint64) []uint64
+		expectedChunks []chunk
+	}{
+		{
+			name: "0x007f hashes. Min size chunks",
+			data: createData(256, 0x00),
+			rollingFunc: func(data []byte, hashes []uint64) []uint64 {
+				for i := windowSize - 1; i < len(data); i++ {
+					hashes = append(hashes, 0x007f)
+				}
+				return hashes
+			},
+			expectedChunks: []chunk{
+				{
+					start:        0,
+					size:         32,
+					stopChecksum: 0x007f,
+				},
+				{
+					start:        32,
+					size:         32,
+					stopChecksum: 0x007f,
+				},
+				{
+					start:        64,
+					size:         32,
+					stopChecksum: 0x007f,
+				},
+				{
+					start:        96,
+					size:         32,
+					stopChecksum: 0x007f,
+				},
+				{
+					start:        128,
+					size:         32,
+					stopChecksum: 0x007f,
+				},
+				{
+					start:        160,
+					size:         32,
+					stopChecksum: 0x007f,
+				},
+				{
+					start:        192,
+					size:         32,
+					stopChecksum: 0x007f,
+				},
+				{
+					start:        224,
+					size:         32,
+					stopChecksum: 0x007f,
+				},
+			},
+		},
+		{
+			name: "0x00 hashes. Max size chunks",
+			data: createData(1200, 0x00),
+			rollingFunc: func(data []byte, hashes []uint64) []uint64 {
+				for i := windowSize - 1; i < len(data); i++ {
+					hashes = append(hashes, 0x00)
+				}
+				return hashes
+			},
+			expectedChunks: []chunk{
+				{
+					start:        0,
+					size:         1024,
+					stopChecksum: 0x00,
+				},
+				{
+					start:        1024,
+					size:         176,
+					stopChecksum: 0x00,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testChunker(defaultChunkParams)
+			c.rollingHash = tt.rollingFunc
+
+			var gotChunks []chunk
+			err := c.resolve(bytes.NewReader(tt.data), func(c chunk, _ []byte) error {
+				gotChunks = append(gotChunks, c)
+				return nil
+			})
+			assert.NoError(t, err, "resolve should not return error")
+
+			if len(gotChunks) != len(tt.expectedChunks) {
+				assert.FailNowf(t, "Expected amount of chunks should be equal to received ones", "%d != %d", len(gotChunks), len(tt.expectedChunks))
+			}
+
+			for i := 0; i < len(tt.expectedChunks); i++ {
+				// We are not interested in hash field's value because it is calculated with sha1 hashing alg and that is
+				// tested elsewhere and trusted to work.
+				assert.Equal(t, tt.expectedChunks[i].size, gotChunks[i].size, "Chunk sizes should be equal")
+				assert.Equal(t, tt.expectedChunks[i].start, gotChunks[i].start, "Chunk start should be equal")
+				assert.Equal(t, tt.expectedChunks[i].stopChecksum, gotChunks[i].stopChecksum, "Chunk stopChecksum should be equal")
+			}
+		})
+	}
+}
+
+func TestResolveChunksAcrossReadBlocks(t *testing.T) {
+	var data = make([]byte, 3*chunkReadSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	// Chunks resolved from whole data at once
+	var c = testChunker(defaultChunkParams)
+	var expectedChunks []chunk
+	var prevIndex int
+	var hash uint64
+
+	for j, h := range calcRollingHash(data, nil) {
+		i := j + windowSize - 1
+		hash = h
+		if (h|chunkSeparator) == h && (i-prevIndex+1) >= chunkMinSize || (i-prevIndex+1) == chunkMaxSize {
+			expectedChunks = append(expectedChunks, c.newChunk(data[prevIndex:i+1], uint64(prevIndex), h))
+			prevIndex = i + 1
+		}
+	}
+	if prevIndex < len(data) {
+		expectedChunks = append(expectedChunks, c.newChunk(data[prevIndex:], uint64(prevIndex), hash))
+	}
+
+	var gotChunks []chunk
+	err := testChunker(defaultChunkParams).resolve(bytes.NewReader(data), func(c chunk, chunkData []byte) error {
+		assert.Equal(t, data[c.start:c.start+c.size], chunkData, "Chunk data should be from chunk's offset")
+
+		gotChunks = append(gotChunks, c)
+		return nil
+	})
+
+	assert.NoError(t, err, "resolve should not return error")
+	assert.Equal(t, expectedChunks, gotChunks, "Chunks should not depend on read blocks")
+}
+
+func TestResolveChunksCallbackError(t *testing.T) {
+	var data = make([]byte, 2*chunkReadSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var calls int
+	err := testChunker(defaultChunkParams).resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+		calls++
+		return errors.New("callback failed")
+	})
+
+	assert.EqualError(t, err, "callback failed")
+	assert.Equal(t, 1, calls, "Chunks should not be resolved after callback fails")
+}
+
+func TestResolveChunksParallel(t *testing.T) {
+	var data = make([]byte, 5*chunkReadSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var params = []chunkParams{
+		defaultChunkParams,
+		{minSize: 4096, maxSize: 4 * chunkReadSize, separator: 0xffff},
+	}
+
+	for _, p := range params {
+		var expectedChunks []chunk
+		err := testChunker(p).resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+			expectedChunks = append(expectedChunks, c)
+			return nil
+		})
+		assert.NoError(t, err, "resolve should not return error")
+
+		for _, jobs := range []int{2, 4, 16} {
+			c := testChunker(p)
+			c.jobs = jobs
+
+			var gotChunks []chunk
+			err = c.resolve(bytes.NewReader(data), func(c chunk, chunkData []byte) error {
+				assert.Equal(t, data[c.start:c.start+c.size], chunkData, "Chunk data should be from chunk's offset")
+
+				gotChunks = append(gotChunks, c)
+				return nil
+			})
+			assert.NoError(t, err, "resolve should not return error")
+			assert.Equal(t, expectedChunks, gotChunks, "Chunks should not depend on jobs")
+		}
+	}
+}
+
+func TestResolveChunksParallelCallbackError(t *testing.T) {
+	var data = make([]byte, 20*chunkReadSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	c := testChunker(defaultChunkParams)
+	c.jobs = 4
+
+	var calls int
+	err := c.resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+		calls++
+		return errors.New("callback failed")
+	})
+
+	assert.EqualError(t, err, "callback failed")
+	assert.Equal(t, 1, calls, "Chunks should not be resolved after callback fails")
+}
+
+func TestResolveChunksParallelReadError(t *testing.T) {
+	var data = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	c := testChunker(defaultChunkParams)
+	c.jobs = 4
+
+	var end uint64
+	err := c.resolve(io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errors.New("read failed"))), func(c chunk, _ []byte) error {
+		end = c.start + c.size
+		return nil
+	})
+
+	assert.EqualError(t, err, "read failed")
+	assert.LessOrEqual(t, end, uint64(len(data)), "Chunks should be only from read data")
+}
+
+func TestResolveChunksWithParams(t *testing.T) {
+	var data = make([]byte, 2*chunkReadSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var tests = []struct {
+		name    string
+		minSize int
+		maxSize int
+		avgSize int
+	}{
+		{
+			name:    "Small chunks",
+			minSize: 16,
+			maxSize: 256,
+			avgSize: 32,
+		},
+		{
+			name:    "Large chunks",
+			minSize: 1024,
+			maxSize: 64 * 1024,
+			avgSize: 8 * 1024,
+		},
+		{
+			name:    "Fixed size chunks",
+			minSize: 4096,
+			maxSize: 4096,
+			avgSize: 1 << 20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newChunkParams(chunkerPolynomial, tt.minSize, tt.maxSize, tt.avgSize)
+			assert.NoError(t, err, "newChunkParams should not return error")
+			assert.Equal(t, uint64(tt.avgSize-1), p.separator, "Separator should have bits of average size")
+
+			var end uint64
+			var count int
+			err = testChunker(p).resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+				assert.Equal(t, end, c.start, "Chunk should start where previous ended")
+				assert.LessOrEqual(t, c.size, uint64(tt.maxSize), "Chunk should not exceed maximum size")
+				if c.start+c.size < uint64(len(data)) {
+					assert.GreaterOrEqual(t, c.size, uint64(tt.minSize), "Chunk should not be smaller than minimum size")
+				}
+
+				end = c.start + c.size
+				count++
+				return nil
+			})
+
+			assert.NoError(t, err, "resolve should not return error")
+			assert.Equal(t, uint64(len(data)), end, "Chunks should cover whole data")
+
+			// Average is a rough estimate as chunks are also limited by minimum and maximum sizes
+			avg := len(data) / count
+			assert.GreaterOrEqual(t, avg, tt.minSize, "Average chunk size should not be below minimum")
+			assert.LessOrEqual(t, avg, tt.minSize+tt.avgSize*2, "Average chunk size should be near expected")
+		})
+	}
+}
+
+func TestNewChunkParamsErrors(t *testing.T) {
+	var tests = []struct {
+		name        string
+		algorithm   uint8
+		minSize     int
+		maxSize     int
+		avgSize     int
+		expectedErr string
+	}{
+		{
+			name:        "Average size not power of two",
+			minSize:     32,
+			maxSize:     1024,
+			avgSize:     100,
+			expectedErr: "average chunk size has to be power of two: 100",
+		},
+		{
+			name:        "Average size too large",
+			minSize:     32,
+			maxSize:     1024,
+			avgSize:     1 << 29,
+			expectedErr: "average chunk size 536870912 is too large for polynomial chunker",
+		},
+		{
+			name:        "Average size too large for 32 bit hash",
+			algorithm:   chunkerBuzhash,
+			minSize:     32,
+			maxSize:     1024,
+			avgSize:     1 << 33,
+			expectedErr: "average chunk size 8589934592 is too large for buzhash chunker",
+		},
+		{
+			name:        "Average size too large for casync discriminator",
+			algorithm:   chunkerCasync,
+			minSize:     32,
+			maxSize:     1024,
+			avgSize:     1 << 24,
+			expectedErr: "average chunk size 16777216 is too large for casync chunker",
+		},
+		{
+			name:        "Zero minimum size",
+			minSize:     0,
+			maxSize:     1024,
+			avgSize:     128,
+			expectedErr: "minimum chunk size has to be positive: 0",
+		},
+		{
+			name:        "Maximum smaller than minimum",
+			minSize:     64,
+			maxSize:     32,
+			avgSize:     128,
+			expectedErr: "maximum chunk size 32 is smaller than minimum chunk size 64",
+		},
+		{
+			name:        "Maximum size over limit",
+			minSize:     32,
+			maxSize:     chunkSizeLimit + 1,
+			avgSize:     128,
+			expectedErr: "maximum chunk size 67108865 exceeds limit 67108864",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newChunkParams(tt.algorithm, tt.minSize, tt.maxSize, tt.avgSize)
+			assert.EqualError(t, err, tt.expectedErr)
+		})
+	}
+
+	// Gear hash has 64 bits, so it can match more separator bits than polynomial hash
+	_, err := newChunkParams(chunkerFastCDC, 32, 1024, 1<<30)
+	assert.NoError(t, err, "Average size of FastCDC should be limited by its hash bits only")
+}
+
+func TestResolveChunksFastCDC(t *testing.T) {
+	var data = make([]byte, 4*chunkReadSize)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	// sizes returns chunk sizes of data resolved with chunking algorithm
+	var sizes = func(algorithm uint8) []float64 {
+		p := defaultChunkParams
+		p.algorithm = algorithm
+
+		var end uint64
+		var sizes []float64
+		err := testChunker(p).resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+			assert.Equal(t, end, c.start, "Chunk should start where previous ended")
+			assert.LessOrEqual(t, c.size, uint64(p.maxSize), "Chunk should not exceed maximum size")
+			if c.start+c.size < uint64(len(data)) {
+				assert.GreaterOrEqual(t, c.size, uint64(p.minSize), "Chunk should not be smaller than minimum size")
+			}
+
+			end = c.start + c.size
+			sizes = append(sizes, float64(c.size))
+			return nil
+		})
+
+		assert.NoError(t, err, "resolve should not return error")
+		assert.Equal(t, uint64(len(data)), end, "Chunks should cover whole data")
+
+		return sizes
+	}
+
+	// deviation returns mean and standard deviation of sizes
+	var deviation = func(sizes []float64) (mean, dev float64) {
+		for _, s := range sizes {
+			mean += s
+		}
+		mean /= float64(len(sizes))
+
+		for _, s := range sizes {
+			dev += (s - mean) * (s - mean)
+		}
+
+		return mean, math.Sqrt(dev / float64(len(sizes)))
+	}
+
+	polyMean, polyDev := deviation(sizes(chunkerPolynomial))
+	cdcMean, cdcDev := deviation(sizes(chunkerFastCDC))
+
+	assert.InDelta(t, chunkSeparator+1, cdcMean, 64, "Average chunk size should be near expected")
+	assert.Less(t, cdcDev, polyDev, "Normalized chunk sizes should vary less (polynomial mean %.0f)", polyMean)
+}
+
+func TestResolveChunksAlgorithms(t *testing.T) {
+	var data = make([]byte, 4*chunkReadSize)
+	rand.New(rand.NewSource(4)).Read(data)
+
+	for _, a := range chunkAlgorithms {
+		t.Run(a.name, func(t *testing.T) {
+			rc, err := SignatureOptions{Chunker: a.name, MaxChunk: 4096}.chunker()
+			assert.NoError(t, err, "chunker should not return error")
+
+			var p = rc.params
+			var ch = testChunker(p)
+			var end uint64
+			var count int
+			err = ch.resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+				assert.Equal(t, end, c.start, "Chunk should start where previous ended")
+				assert.LessOrEqual(t, c.size, uint64(p.maxSize), "Chunk should not exceed maximum size")
+
+				end = c.start + c.size
+				count++
+				return nil
+			})
+
+			assert.NoError(t, err, "resolve should not return error")
+			assert.Equal(t, uint64(len(data)), end, "Chunks should cover whole data")
+
+			// Chunks of reset algorithms can end only after a whole window, which adds to average size
+			var expected = int(p.separator + 1)
+			if ch.reset {
+				expected += ch.first - p.minSize
+			}
+			assert.InDelta(t, expected, len(data)/count, 64, "Average chunk size should be near expected")
+		})
+	}
+}
+
+func TestResolveChunksMaxSizeOfWindow(t *testing.T) {
+	var data = make([]byte, chunkReadSize)
+	rand.New(rand.NewSource(6)).Read(data)
+
+	for _, a := range chunkAlgorithms {
+		t.Run(a.name, func(t *testing.T) {
+			// Chunk shorter than window could not end at a boundary, so chunks would exceed maximum size
+			_, err := SignatureOptions{Chunker: a.name, MinChunk: 2, MaxChunk: a.window - 1, AvgChunk: 4}.chunker()
+			assert.EqualError(t, err, fmt.Sprintf("maximum chunk size %d is smaller than %d byte window of %s chunker",
+				a.window-1, a.window, a.name))
+
+			rc, err := SignatureOptions{Chunker: a.name, MinChunk: 2, MaxChunk: a.window, AvgChunk: 4}.chunker()
+			assert.NoError(t, err, "chunker should not return error")
+
+			var end uint64
+			err = testChunker(rc.params).resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+				assert.LessOrEqual(t, c.size, uint64(a.window), "Chunk at %d should not exceed maximum size", c.start)
+
+				end = c.start + c.size
+				return nil
+			})
+
+			assert.NoError(t, err, "resolve should not return error")
+			assert.Equal(t, uint64(len(data)), end, "Chunks should cover whole data")
+		})
+	}
+}
+
+func TestChunkAlgorithmByName(t *testing.T) {
+	id, err := chunkAlgorithmByName("FastCDC")
+	assert.NoError(t, err, "chunkAlgorithmByName should not return error")
+	assert.Equal(t, chunkerFastCDC, id, "Name should be case insensitive")
+
+	_, err = chunkAlgorithmByName("ae")
+	assert.EqualError(t, err, "unknown chunker: ae (supported: polynomial, fastcdc, rabin, buzhash, casync)")
+
+	_, err = chunkParams{algorithm: 9}.chunkAlgorithm()
+	assert.EqualError(t, err, "unknown chunker: 9")
+}
+
+func benchmarkResolveChunks(b *testing.B, p chunkParams, jobs int) {
+	var data = make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		c := testChunker(p)
+		c.jobs = jobs
+
+		c.resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+			return nil
+		})
+	}
+}
+
+func BenchmarkResolveChunks(b *testing.B) {
+	benchmarkResolveChunks(b, defaultChunkParams, 1)
+}
+
+func BenchmarkResolveChunksJobs4(b *testing.B) {
+	benchmarkResolveChunks(b, defaultChunkParams, 4)
+}
+
+func BenchmarkResolveChunksFastCDC(b *testing.B) {
+	var p = defaultChunkParams
+	p.algorithm = chunkerFastCDC
+
+	benchmarkResolveChunks(b, p, 1)
+}
@@ -0,0 +1,399 @@
+// Package datadiff creates signatures of basis files, deltas of changed files against signatures and applies deltas
+// to basis files. Signatures are in data-diff or rdiff (librsync) format. Deltas are in data-diff, rdiff, VCDIFF or
+// BSDIFF40 format.
+package datadiff
+
+import (
+	"fmt"
+	"io"
+)
+
+// Signature and delta formats
+const (
+	// FormatDataDiff signature contains content defined chunks of basis file. FormatDataDiff delta is rdiff delta
+	// followed by checksums of basis and new file.
+	FormatDataDiff = "data-diff"
+
+	// FormatRdiff signature is librsync signature of fixed size blocks. FormatRdiff delta is librsync delta.
+	FormatRdiff = "rdiff"
+)
+
+// Delta formats
+const (
+	// FormatVcdiff delta is VCDIFF (RFC 3284) delta without checksums
+	FormatVcdiff = "vcdiff"
+
+	// FormatBsdiff delta is BSDIFF40 delta of bsdiff 4 without checksums
+	FormatBsdiff = "bsdiff"
+)
+
+// Chunking algorithms of data-diff signature
+const (
+	// ChunkerPolynomial finds boundaries with polynomial rolling hash of 16 byte window. It is the default and the only
+	// algorithm of signatures before version 4.
+	ChunkerPolynomial = "polynomial"
+
+	// ChunkerFastCDC finds boundaries with gear hash and normalized chunking of FastCDC
+	ChunkerFastCDC = "fastcdc"
+
+	// ChunkerRabin finds boundaries with Rabin fingerprint of 64 byte window like restic, so with restic's chunk sizes
+	// and polynomial the chunks are the same as restic's
+	ChunkerRabin = "rabin"
+
+	// ChunkerBuzhash finds boundaries with buzhash of 48 byte window where the separator bits of hash are zero. Its
+	// table can be replaced and XORed with a seed.
+	ChunkerBuzhash = "buzhash"
+
+	// ChunkerCasync finds boundaries with buzhash table and boundary condition of casync, so with casync's chunk sizes
+	// the chunks are the same as casync's
+	ChunkerCasync = "casync"
+)
+
+// Names of files in error messages
+const (
+	argSignature = "SIGNATURE"
+	argDelta     = "DELTA"
+	argNewFile   = "NEWFILE"
+	argOldFile   = "BASIS"
+)
+
+// logger traces internal processing of one operation. Nil logger discards the trace.
+type logger struct {
+	w io.Writer
+}
+
+// newLogger creates logger that writes to w or nil logger if w is nil
+func newLogger(w io.Writer) *logger {
+	if w == nil {
+		return nil
+	}
+
+	return &logger{w: w}
+}
+
+// enabled tells whether trace is written, so that expensive trace params are not created in vain
+func (l *logger) enabled() bool {
+	return l != nil
+}
+
+// println writes params to trace
+func (l *logger) println(params ...interface{}) {
+	if l != nil {
+		fmt.Fprintln(l.w, params...)
+	}
+}
+
+// SignatureOptions select the format of signature and how basis file is split. Zero values select defaults.
+type SignatureOptions struct {
+	// Format is FormatDataDiff (default) or FormatRdiff
+	Format string
+
+	// Chunker is the chunking algorithm of data-diff signature: ChunkerPolynomial (default), ChunkerFastCDC,
+	// ChunkerRabin, ChunkerBuzhash or ChunkerCasync
+	Chunker string
+
+	// RabinPolynomial is irreducible polynomial of ChunkerRabin, degree between 32 and 56. Default is 0x3DA3358B4DC173.
+	RabinPolynomial uint64
+
+	// BuzhashTable contains 256 values of ChunkerBuzhash, each XORed with BuzhashSeed. Default is a fixed random table.
+	BuzhashTable []uint32
+	BuzhashSeed  uint32
+
+	// Chunk sizes of data-diff signature in bytes. Average size has to be power of two.
+	MinChunk int
+	MaxChunk int
+	AvgChunk int
+
+	// Block size of rdiff signature in bytes
+	BlockSize int
+
+	// Hash is strong hash of chunks: sha1 (default), sha256 or blake2b. With rdiff format md4 or blake2b (default).
+	Hash string
+
+	// HashSize truncates strong hash to HashSize bytes
+	HashSize int
+
+	// Jobs is the number of goroutines that calculate strong hashes of chunks. Output does not depend on it.
+	Jobs int
+
+	// Log receives trace of internal processing if it is not nil
+	Log io.Writer
+}
+
+// Validate checks that options are supported
+func (o SignatureOptions) Validate() error {
+	switch o.Format {
+	case "", FormatDataDiff:
+		_, err := o.chunker()
+		return err
+	case FormatRdiff:
+		_, err := o.rdiffParams()
+		return err
+	}
+
+	return fmt.Errorf("unsupported signature format: %s", o.Format)
+}
+
+// chunker creates chunker of data-diff signature
+func (o SignatureOptions) chunker() (*rollingChunker, error) {
+	var p = defaultChunkParams
+	var err error
+
+	if o.Chunker != "" {
+		p.algorithm, err = chunkAlgorithmByName(o.Chunker)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.MinChunk != 0 || o.MaxChunk != 0 || o.AvgChunk != 0 {
+		var minSize, maxSize, avgSize = o.MinChunk, o.MaxChunk, o.AvgChunk
+		if minSize == 0 {
+			minSize = chunkMinSize
+		}
+		if maxSize == 0 {
+			maxSize = chunkMaxSize
+		}
+		if avgSize == 0 {
+			avgSize = chunkSeparator + 1
+		}
+
+		p, err = newChunkParams(p.algorithm, minSize, maxSize, avgSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case p.algorithm == chunkerRabin:
+		p.polynomial = defaultRabinPolynomial
+		if o.RabinPolynomial != 0 {
+			p.polynomial = o.RabinPolynomial
+		}
+
+		err = checkRabinPolynomial(p.polynomial)
+		if err != nil {
+			return nil, err
+		}
+	case o.RabinPolynomial != 0:
+		return nil, fmt.Errorf("rabin polynomial requires %s chunker", ChunkerRabin)
+	}
+
+	switch {
+	case p.algorithm == chunkerBuzhash:
+		p.table, err = newBuzhashTable(o.BuzhashTable, o.BuzhashSeed)
+		if err != nil {
+			return nil, err
+		}
+	case o.BuzhashTable != nil || o.BuzhashSeed != 0:
+		return nil, fmt.Errorf("buzhash table requires %s chunker", ChunkerBuzhash)
+	}
+
+	var hp = defaultHashParams
+	if o.Hash != "" || o.HashSize != 0 {
+		var name = o.Hash
+		if name == "" {
+			name = "sha1"
+		}
+
+		hp, err = newHashParams(name, o.HashSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &rollingChunker{params: p, hashParams: hp, jobs: o.Jobs, log: o.Log}, nil
+}
+
+// rdiffParams creates parameters of rdiff signature
+func (o SignatureOptions) rdiffParams() (rdiffParams, error) {
+	var name, blockLen = o.Hash, o.BlockSize
+	if name == "" {
+		name = "blake2b"
+	}
+	if blockLen == 0 {
+		blockLen = RS_DEFAULT_BLOCK_LEN
+	}
+
+	return newRdiffParams(name, blockLen, o.HashSize)
+}
+
+// Signature writes signature of basis to out
+func Signature(basis io.Reader, out io.Writer, opts SignatureOptions) error {
+	if opts.Format == FormatRdiff {
+		p, err := opts.rdiffParams()
+		if err != nil {
+			return err
+		}
+
+		return createRdiffSignature(basis, out, p)
+	}
+
+	if opts.Format != "" && opts.Format != FormatDataDiff {
+		return fmt.Errorf("unsupported signature format: %s", opts.Format)
+	}
+
+	c, err := opts.chunker()
+	if err != nil {
+		return err
+	}
+
+	return createSignature(basis, out, c.params, c.hashParams, opts.Jobs, newLogger(opts.Log))
+}
+
+// DeltaOptions control how delta is created
+type DeltaOptions struct {
+	// Format is FormatDataDiff, FormatRdiff, FormatVcdiff or FormatBsdiff. Data-diff delta is rdiff delta followed
+	// by checksums of basis and new file, which patch verifies. By default deltas of data-diff signatures are in
+	// data-diff format and deltas of rdiff signatures in strict rdiff format.
+	Format string
+
+	// ByteMatch searches chunks of data-diff signature at every byte offset of new file instead of comparing chunks
+	// of new file. Chunks of rdiff signature are always searched at every offset.
+	ByteMatch bool
+
+	// Jobs is the number of goroutines that calculate strong hashes of new file's chunks when ByteMatch is not set
+	Jobs int
+
+	// Log receives trace of internal processing if it is not nil
+	Log io.Writer
+}
+
+// Validate checks that options are supported
+func (o DeltaOptions) Validate() error {
+	switch o.Format {
+	case "", FormatDataDiff, FormatRdiff, FormatVcdiff, FormatBsdiff:
+		return nil
+	}
+
+	return fmt.Errorf("unsupported delta format: %s", o.Format)
+}
+
+// newDeltaBuffer creates DeltaBuffer of format writing to out
+func newDeltaBuffer(format string, out io.Writer) DeltaBuffer {
+	switch format {
+	case FormatVcdiff:
+		return NewVcdiffDelta(out)
+	case FormatBsdiff:
+		return NewBsdiffDelta(out)
+	}
+
+	return NewRdiffDelta(out)
+}
+
+// Delta writes delta of newFile against the basis file of signature to out. Signature format is detected from its
+// magic.
+func Delta(signature, newFile io.Reader, out io.Writer, opts DeltaOptions) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
+	return createDelta(signature, newFile, newDeltaBuffer(opts.Format, out), opts)
+}
+
+// DiffOptions control how delta is created from basis and new file
+type DiffOptions struct {
+	// Format is FormatDataDiff (default), FormatRdiff, FormatVcdiff or FormatBsdiff like in DeltaOptions. Bsdiff
+	// delta is created with the approximate matches of bsdiff.
+	Format string
+
+	// MinMatch is the minimum length of data copied from basis file in bytes, default 16. Shorter matches are written
+	// as literals. Bsdiff format does not use it.
+	MinMatch int
+
+	// Log receives trace of internal processing if it is not nil
+	Log io.Writer
+}
+
+// Validate checks that options are supported
+func (o DiffOptions) Validate() error {
+	if o.MinMatch != 0 && o.MinMatch < diffHashSize {
+		return fmt.Errorf("minimum match has to be at least %d bytes: %d", diffHashSize, o.MinMatch)
+	}
+
+	return DeltaOptions{Format: o.Format}.Validate()
+}
+
+// Diff writes delta of newFile against basis to out without a signature. Both files are read to memory, and data of
+// basis is copied wherever it is found in newFile, so delta is usually smaller than delta of signature.
+func Diff(basis, newFile io.Reader, out io.Writer, opts DiffOptions) error {
+	err := opts.Validate()
+	if err != nil {
+		return err
+	}
+
+	if opts.Format == FormatBsdiff {
+		return createBsdiff(basis, newFile, newBsdiffDelta(out), opts)
+	}
+
+	return createDiff(basis, newFile, newDeltaBuffer(opts.Format, out), opts)
+}
+
+// PatchOptions control how delta is applied
+type PatchOptions struct {
+	// Log receives trace of internal processing if it is not nil
+	Log io.Writer
+}
+
+// Patch applies rdiff, data-diff, VCDIFF or BSDIFF40 delta to basis and writes the result to out. Checksums of
+// data-diff delta are verified after the result is written, so out should be discarded if error matches
+// ErrChecksumMismatch.
+func Patch(basis io.ReaderAt, delta io.Reader, out io.Writer, opts PatchOptions) error {
+	return applyPatch(basis, delta, out, newLogger(opts.Log))
+}
+
+// Chunk is content defined chunk of a file
+type Chunk struct {
+	// Offset and size of chunk in the file
+	Start uint64
+	Size  uint64
+
+	// StopChecksum is the rolling hash at the end of chunk
+	StopChecksum uint64
+
+	// Hash is truncated strong hash of chunk data
+	Hash []byte
+}
+
+// Chunker splits data to content defined chunks. Chunks can be called concurrently.
+type Chunker interface {
+	// Chunks reads data from r and calls fn for each chunk with the chunk's data. Data slice is valid only until fn
+	// returns.
+	Chunks(r io.Reader, fn func(c Chunk, data []byte) error) error
+}
+
+// NewChunker creates Chunker that splits data like data-diff signature with opts does
+func NewChunker(opts SignatureOptions) (Chunker, error) {
+	if opts.Format != "" && opts.Format != FormatDataDiff {
+		return nil, fmt.Errorf("signature format %s has no chunks", opts.Format)
+	}
+
+	return opts.chunker()
+}
+
+// rollingChunker splits data where rolling hash of chunking algorithm meets the boundary condition
+type rollingChunker struct {
+	params     chunkParams
+	hashParams hashParams
+	jobs       int
+	log        io.Writer
+}
+
+// Chunks implements Chunker
+func (rc *rollingChunker) Chunks(r io.Reader, fn func(c Chunk, data []byte) error) error {
+	// Each call has its own chunker as hash state can not be shared
+	c, err := newChunker(rc.params, rc.hashParams, rc.jobs, newLogger(rc.log))
+	if err != nil {
+		return err
+	}
+
+	return c.resolve(r, func(c chunk, data []byte) error {
+		return fn(Chunk{
+			Start:        c.start,
+			Size:         c.size,
+			StopChecksum: c.stopChecksum,
+			Hash:         c.hash,
+		}, data)
+	})
+}
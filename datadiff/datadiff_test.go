@@ -0,0 +1,372 @@
+package datadiff
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatureDeltaPatch(t *testing.T) {
+	var basis = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(3)).Read(basis)
+
+	var modified = append([]byte("Prefix"), basis[:chunkReadSize]...)
+	modified = append(modified, basis[2*chunkReadSize:]...)
+
+	var tests = []struct {
+		name         string
+		sigOpts      SignatureOptions
+		deltaOpts    DeltaOptions
+		expectedHead string
+	}{
+		{
+			name:         "Default options",
+			expectedHead: signatureMagic,
+		},
+		{
+			name: "Chunk and hash options",
+			sigOpts: SignatureOptions{
+				MinChunk: 64,
+				AvgChunk: 512,
+				Hash:     "sha256",
+				HashSize: 16,
+			},
+			deltaOpts: DeltaOptions{
+				ByteMatch: true,
+			},
+			expectedHead: signatureMagic,
+		},
+		{
+			name: "FastCDC chunker",
+			sigOpts: SignatureOptions{
+				Chunker: ChunkerFastCDC,
+			},
+			expectedHead: signatureMagic,
+		},
+		{
+			name: "FastCDC chunker with byte match",
+			sigOpts: SignatureOptions{
+				Chunker:  ChunkerFastCDC,
+				AvgChunk: 1024,
+				MaxChunk: 4096,
+			},
+			deltaOpts: DeltaOptions{
+				ByteMatch: true,
+			},
+			expectedHead: signatureMagic,
+		},
+		{
+			name: "Rabin chunker",
+			sigOpts: SignatureOptions{
+				Chunker:         ChunkerRabin,
+				RabinPolynomial: 0x100400007,
+			},
+			expectedHead: signatureMagic,
+		},
+		{
+			name: "Buzhash chunker",
+			sigOpts: SignatureOptions{
+				Chunker:     ChunkerBuzhash,
+				BuzhashSeed: 0xdeadbeef,
+			},
+			deltaOpts: DeltaOptions{
+				ByteMatch: true,
+			},
+			expectedHead: signatureMagic,
+		},
+		{
+			name: "Rdiff signature",
+			sigOpts: SignatureOptions{
+				Format:    FormatRdiff,
+				BlockSize: 512,
+			},
+			expectedHead: "rs\x017",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := &bytes.Buffer{}
+			err := Signature(bytes.NewReader(basis), sig, tt.sigOpts)
+			assert.NoError(t, err, "Signature should not return error")
+			assert.Equal(t, tt.expectedHead, string(sig.Bytes()[:4]), "Signature should start with magic of format")
+
+			delta := &bytes.Buffer{}
+			err = Delta(sig, bytes.NewReader(modified), delta, tt.deltaOpts)
+			assert.NoError(t, err, "Delta should not return error")
+			assert.Less(t, delta.Len(), len(modified)/10, "Delta should mostly consist of copy commands")
+
+			got := &bytes.Buffer{}
+			err = Patch(bytes.NewReader(basis), delta, got, PatchOptions{})
+			assert.NoError(t, err, "Patch should not return error")
+			assert.True(t, bytes.Equal(modified, got.Bytes()), "Patched data should equal to modified data")
+		})
+	}
+}
+
+func TestSignatureOptionsValidate(t *testing.T) {
+	var tests = []struct {
+		name        string
+		opts        SignatureOptions
+		expectedErr string
+	}{
+		{
+			name: "Default options",
+		},
+		{
+			name: "Rdiff with MD4",
+			opts: SignatureOptions{
+				Format: FormatRdiff,
+				Hash:   "md4",
+			},
+		},
+		{
+			name: "Unknown format",
+			opts: SignatureOptions{
+				Format: "zip",
+			},
+			expectedErr: "unsupported signature format: zip",
+		},
+		{
+			name: "Invalid chunk size",
+			opts: SignatureOptions{
+				MinChunk: 2048,
+			},
+			expectedErr: "maximum chunk size 1024 is smaller than minimum chunk size 2048",
+		},
+		{
+			name: "Unknown chunker",
+			opts: SignatureOptions{
+				Chunker: "ae",
+			},
+			expectedErr: "unknown chunker: ae (supported: polynomial, fastcdc, rabin, buzhash, casync)",
+		},
+		{
+			name: "Reducible rabin polynomial",
+			opts: SignatureOptions{
+				Chunker:         ChunkerRabin,
+				RabinPolynomial: 1<<40 | 1,
+			},
+			expectedErr: "rabin polynomial 0x10000000001 is not irreducible",
+		},
+		{
+			name: "Rabin polynomial of other chunker",
+			opts: SignatureOptions{
+				RabinPolynomial: defaultRabinPolynomial,
+			},
+			expectedErr: "rabin polynomial requires rabin chunker",
+		},
+		{
+			name: "Short buzhash table",
+			opts: SignatureOptions{
+				Chunker:      ChunkerBuzhash,
+				BuzhashTable: make([]uint32, 16),
+			},
+			expectedErr: "buzhash table has to have 256 values: 16",
+		},
+		{
+			name: "Buzhash seed of other chunker",
+			opts: SignatureOptions{
+				Chunker:     ChunkerFastCDC,
+				BuzhashSeed: 1,
+			},
+			expectedErr: "buzhash table requires buzhash chunker",
+		},
+		{
+			name: "Rdiff hash in data-diff signature",
+			opts: SignatureOptions{
+				Hash: "md4",
+			},
+			expectedErr: "unknown strong hash: md4 (supported: sha1, sha256, blake2b)",
+		},
+		{
+			name: "Too long rdiff strong sum",
+			opts: SignatureOptions{
+				Format:   FormatRdiff,
+				HashSize: 64,
+			},
+			expectedErr: "strong sum size has to be between 1 and 32: 64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "Validate should not return error")
+		})
+	}
+}
+
+func TestChunker(t *testing.T) {
+	var data = make([]byte, 2*chunkReadSize)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	c, err := NewChunker(SignatureOptions{})
+	assert.NoError(t, err, "NewChunker should not return error")
+
+	var expected []Chunk
+	err = testChunker(defaultChunkParams).resolve(bytes.NewReader(data), func(c chunk, _ []byte) error {
+		expected = append(expected, Chunk{
+			Start:        c.start,
+			Size:         c.size,
+			StopChecksum: c.stopChecksum,
+			Hash:         c.hash,
+		})
+		return nil
+	})
+	assert.NoError(t, err, "resolve should not return error")
+
+	var got []Chunk
+	err = c.Chunks(bytes.NewReader(data), func(c Chunk, chunkData []byte) error {
+		assert.Equal(t, data[c.Start:c.Start+c.Size], chunkData, "Chunk data should be from chunk's offset")
+
+		got = append(got, c)
+		return nil
+	})
+	assert.NoError(t, err, "Chunks should not return error")
+	assert.Equal(t, expected, got, "Chunks should equal to chunks of signature")
+
+	_, err = NewChunker(SignatureOptions{Format: FormatRdiff})
+	assert.EqualError(t, err, "signature format rdiff has no chunks")
+}
+
+func TestConcurrentSignatures(t *testing.T) {
+	const files = 16
+
+	var opts = []SignatureOptions{
+		{},
+		{Hash: "blake2b", HashSize: 8},
+		{Format: FormatRdiff, BlockSize: 256},
+	}
+
+	var data = make([][]byte, files)
+	var expected = make([][]byte, files)
+	for i := 0; i < files; i++ {
+		data[i] = make([]byte, chunkReadSize+i*1000)
+		rand.New(rand.NewSource(int64(i))).Read(data[i])
+
+		sig := &bytes.Buffer{}
+		err := Signature(bytes.NewReader(data[i]), sig, opts[i%len(opts)])
+		assert.NoError(t, err, "Signature should not return error")
+		expected[i] = sig.Bytes()
+	}
+
+	// Chunker is shared by goroutines
+	chunker, err := NewChunker(SignatureOptions{})
+	assert.NoError(t, err, "NewChunker should not return error")
+
+	var wg sync.WaitGroup
+	for i := 0; i < files; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			sig := &bytes.Buffer{}
+			err := Signature(bytes.NewReader(data[i]), sig, opts[i%len(opts)])
+			assert.NoError(t, err, "Signature should not return error")
+			assert.Equal(t, expected[i], sig.Bytes(), "Concurrent signature should equal to sequential one")
+
+			delta := &bytes.Buffer{}
+			err = Delta(sig, bytes.NewReader(data[i]), delta, DeltaOptions{ByteMatch: i%2 == 0})
+			assert.NoError(t, err, "Delta should not return error")
+
+			got := &bytes.Buffer{}
+			err = Patch(bytes.NewReader(data[i]), delta, got, PatchOptions{})
+			assert.NoError(t, err, "Patch should not return error")
+			assert.True(t, bytes.Equal(data[i], got.Bytes()), "Patched data should equal to new file")
+
+			var end uint64
+			err = chunker.Chunks(bytes.NewReader(data[i]), func(c Chunk, _ []byte) error {
+				end = c.Start + c.Size
+				return nil
+			})
+			assert.NoError(t, err, "Chunks should not return error")
+			assert.Equal(t, uint64(len(data[i])), end, "Chunks should cover whole file")
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLog(t *testing.T) {
+	var data = []byte(strings.Repeat("Logged data. ", 100))
+
+	log := &bytes.Buffer{}
+	sig := &bytes.Buffer{}
+	err := Signature(bytes.NewReader(data), sig, SignatureOptions{Log: log})
+	assert.NoError(t, err, "Signature should not return error")
+	assert.Contains(t, log.String(), "Logged data.", "Signature should trace chunk data")
+
+	log.Reset()
+	delta := &bytes.Buffer{}
+	err = Delta(sig, bytes.NewReader(data), delta, DeltaOptions{Log: log})
+	assert.NoError(t, err, "Delta should not return error")
+	assert.Contains(t, log.String(), "Finding differences:", "Delta should trace processing")
+
+	log.Reset()
+	err = Patch(bytes.NewReader(data), delta, &bytes.Buffer{}, PatchOptions{Log: log})
+	assert.NoError(t, err, "Patch should not return error")
+	assert.Equal(t, "COPY 0 1300\nEND\n", log.String(), "Patch should trace commands")
+}
+
+func TestSmallFiles(t *testing.T) {
+	for _, size := range []int{0, 1, windowSize - 1, windowSize, windowSize + 1} {
+		var basis = make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(basis)
+
+		// New file of same size shares no data with basis
+		var newFile = bytes.Repeat([]byte{'x'}, size)
+
+		for _, format := range []string{FormatDataDiff, FormatRdiff} {
+			for _, byteMatch := range []bool{false, true} {
+				t.Run(fmt.Sprintf("%d bytes %s byteMatch %t", size, format, byteMatch), func(t *testing.T) {
+					sig := &bytes.Buffer{}
+					err := Signature(bytes.NewReader(basis), sig, SignatureOptions{Format: format})
+					assert.NoError(t, err, "Signature should not return error")
+
+					if format == FormatDataDiff {
+						_, chunks, err := readSignature(bytes.NewReader(sig.Bytes()), int64(sig.Len()))
+						assert.NoError(t, err, "readSignature should not return error")
+
+						if size == 0 {
+							assert.Empty(t, chunks, "Empty file should have empty signature")
+						} else {
+							assert.Len(t, chunks, 1, "File smaller than minimum chunk should be a single chunk")
+						}
+					}
+
+					for _, data := range [][]byte{basis, newFile} {
+						delta := &bytes.Buffer{}
+						err = Delta(bytes.NewReader(sig.Bytes()), bytes.NewReader(data), delta, DeltaOptions{ByteMatch: byteMatch})
+						assert.NoError(t, err, "Delta should not return error")
+
+						got := &bytes.Buffer{}
+						err = Patch(bytes.NewReader(basis), bytes.NewReader(delta.Bytes()), got, PatchOptions{})
+						assert.NoError(t, err, "Patch should not return error")
+						assert.True(t, bytes.Equal(data, got.Bytes()), "Patched data should equal to new file")
+					}
+
+					deltaB := &mockDeltaBuffer{}
+					err = createDelta(bytes.NewReader(sig.Bytes()), bytes.NewReader(newFile), deltaB, DeltaOptions{ByteMatch: byteMatch})
+					assert.NoError(t, err, "createDelta should not return error")
+
+					var expected []deltaCommand
+					if size > 0 {
+						expected = []deltaCommand{{command: COMMAND_LITERAL, data: newFile}}
+					}
+					assert.Equal(t, expected, deltaB.commands, "Delta of changed file should be pure literal")
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package datadiff
+
+// gearWindowSize is the window of gear hash. Each byte is shifted out of the 64 bit hash after 64 bytes.
+const gearWindowSize = 64
+
+// gearTable contains random value of each byte for gear hash. Values are generated with splitmix64 from a fixed seed
+// and must never change, as chunks of stored signatures depend on them.
+var gearTable = func() (t [256]uint64) {
+	var state = uint64(0x6461746164696666) // "datadiff"
+
+	for i := range t {
+		state += 0x9e3779b97f4a7c15
+
+		z := state
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		t[i] = z ^ z>>31
+	}
+
+	return
+}()
+
+// calcGearHash calculates gear hash of each window of data and appends them to hashes. The hash of window ending to
+// data[i] is at index i-(gearWindowSize-1) of appended hashes. Data shorter than gearWindowSize has no windows.
+func calcGearHash(data []byte, hashes []uint64) []uint64 {
+	if len(data) < gearWindowSize {
+		return hashes
+	}
+
+	var hash uint64
+	for _, b := range data[:gearWindowSize-1] {
+		hash = hash<<1 + gearTable[b]
+	}
+
+	for _, b := range data[gearWindowSize-1:] {
+		hash = hash<<1 + gearTable[b]
+		hashes = append(hashes, hash)
+	}
+
+	return hashes
+}
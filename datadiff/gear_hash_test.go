@@ -0,0 +1,71 @@
+package datadiff
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGearTable(t *testing.T) {
+	// Chunks of stored fastcdc signatures depend on the table
+	assert.Equal(t, uint64(0x066b2c82f38e8df6), gearTable[0], "First value of gear table should not change")
+	assert.Equal(t, uint64(0xeaee0133b73181f5), gearTable[1], "Second value of gear table should not change")
+	assert.Equal(t, uint64(0x05f9568301e96b61), gearTable[255], "Last value of gear table should not change")
+
+	var seen = map[uint64]bool{}
+	for _, v := range gearTable {
+		seen[v] = true
+	}
+	assert.Len(t, seen, len(gearTable), "Values of gear table should be unique")
+}
+
+func TestCalcGearHash(t *testing.T) {
+	var data = make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	hashes := calcGearHash(data, nil)
+
+	assert.Len(t, hashes, len(data)-gearWindowSize+1, "There should be hash for each window")
+	assert.Equal(t, uint64(0xd6309da5fe344208), hashes[0], "Hash of first window should not change")
+	assert.Equal(t, uint64(0x0ae87b676ff9d835), hashes[len(hashes)-1], "Hash of last window should not change")
+}
+
+func TestCalcGearHashWindow(t *testing.T) {
+	var data = make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	hashes := calcGearHash(data, nil)
+
+	for i := gearWindowSize - 1; i < len(data); i++ {
+		// Hash should depend only on the bytes of window
+		window := calcGearHash(data[i-gearWindowSize+1:i+1], nil)
+
+		assert.Equal(t, window[0], hashes[i-gearWindowSize+1], "Hash of window ending at %d should match", i)
+	}
+}
+
+func TestCalcGearHashShortData(t *testing.T) {
+	for _, size := range []int{0, 1, gearWindowSize - 1} {
+		hashes := calcGearHash(make([]byte, size), []uint64{7})
+
+		assert.Equal(t, []uint64{7}, hashes, "Data of %d bytes should have no windows", size)
+	}
+
+	assert.Len(t, calcGearHash(make([]byte, gearWindowSize), nil), 1, "Data of window size should have one window")
+}
+
+func BenchmarkCalcGearHash(b *testing.B) {
+	var data = make([]byte, 1<<20)
+	var hashes = make([]uint64, 0, len(data))
+	rand.New(rand.NewSource(1)).Read(data)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		hashes = calcGearHash(data, hashes[:0])
+	}
+}
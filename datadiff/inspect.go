@@ -0,0 +1,534 @@
+package datadiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// InspectOptions control how Inspect describes files
+type InspectOptions struct {
+	// JSON writes the description as JSON document instead of text
+	JSON bool
+}
+
+// Inspect detects whether file is data-diff signature, rdiff signature, rdiff, VCDIFF or BSDIFF40 delta and writes
+// its description to out
+func Inspect(file io.Reader, out io.Writer, opts InspectOptions) error {
+	var size = remainingSize(file)
+	var r = bufio.NewReader(file)
+
+	var d description
+	var err error
+
+	head, _ := r.Peek(8)
+	switch {
+	case len(head) >= 4 && string(head[:4]) == RS_DELTA_MAGIC:
+		d, err = inspectDelta(r)
+	case len(head) >= 4 && string(head[:4]) == VCDIFF_MAGIC:
+		d, err = inspectVcdiffDelta(r)
+	case string(head) == BSDIFF_MAGIC:
+		d, err = inspectBsdiffDelta(r)
+	case isRdiffSignature(head):
+		d, err = inspectRdiffSignature(r)
+	default:
+		d, err = inspectSignature(r, size, head)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+
+	w := bufio.NewWriter(out)
+	d.writeText(w)
+	return w.Flush()
+}
+
+// description is inspected file which can be written as text or JSON
+type description interface {
+	// writeText writes human readable description to w. Write errors remain in w.
+	writeText(w *bufio.Writer)
+}
+
+// signatureInfo describes data-diff signature
+type signatureInfo struct {
+	Type       string `json:"type"`
+	Format     string `json:"format"`
+	Version    uint32 `json:"version"`
+	Chunker    string `json:"chunker"`
+	WindowSize uint32 `json:"windowSize"`
+	MinChunk   int    `json:"minChunk"`
+	MaxChunk   int    `json:"maxChunk"`
+	AvgChunk   uint64 `json:"avgChunk"`
+	Hash       string `json:"hash"`
+	HashSize   int    `json:"hashSize"`
+
+	// Rolling hash parameters of rabin and buzhash chunkers. Table of buzhash is described by its seed if it is
+	// created from the default table.
+	RabinPolynomial string  `json:"rabinPolynomial,omitempty"`
+	BuzhashSeed     *uint32 `json:"buzhashSeed,omitempty"`
+	BuzhashTable    string  `json:"buzhashTable,omitempty"`
+
+	// Checksum of whole basis file or empty if signature has none
+	Checksum string `json:"checksum,omitempty"`
+
+	ChunkCount int         `json:"chunkCount"`
+	TotalSize  uint64      `json:"totalSize"`
+	Sizes      sizeStats   `json:"sizes"`
+	Chunks     []chunkInfo `json:"chunks"`
+}
+
+// chunkInfo describes chunk of signature
+type chunkInfo struct {
+	Start        uint64 `json:"start"`
+	Size         uint64 `json:"size"`
+	StopChecksum uint64 `json:"stopChecksum"`
+	Hash         string `json:"hash"`
+}
+
+// sizeStats describes distribution of chunk sizes
+type sizeStats struct {
+	Min  uint64  `json:"min"`
+	Max  uint64  `json:"max"`
+	Mean float64 `json:"mean"`
+
+	// Histogram has a bucket for each power of two from the smallest to the largest chunk
+	Histogram []sizeBucket `json:"histogram"`
+}
+
+// sizeBucket counts chunks which size is between From and To inclusive
+type sizeBucket struct {
+	From  uint64 `json:"from"`
+	To    uint64 `json:"to"`
+	Count int    `json:"count"`
+}
+
+// newSizeStats calculates distribution of sizes
+func newSizeStats(sizes []uint64) (s sizeStats) {
+	if len(sizes) == 0 {
+		return
+	}
+
+	var total float64
+	var buckets [64]int
+	s.Min = sizes[0]
+	for _, size := range sizes {
+		if size < s.Min {
+			s.Min = size
+		}
+		if size > s.Max {
+			s.Max = size
+		}
+		total += float64(size)
+		buckets[bits.Len64(size)-1]++
+	}
+	s.Mean = total / float64(len(sizes))
+
+	for i := bits.Len64(s.Min) - 1; i < bits.Len64(s.Max); i++ {
+		s.Histogram = append(s.Histogram, sizeBucket{
+			From:  1 << i,
+			To:    1<<(i+1) - 1,
+			Count: buckets[i],
+		})
+	}
+
+	return
+}
+
+// inspectSignature reads data-diff signature from r. Head is the start of signature and size is the size of whole
+// signature or negative if it is not known.
+func inspectSignature(r io.Reader, size int64, head []byte) (*signatureInfo, error) {
+	var version = uint32(1)
+	if len(head) >= 8 && string(head[:4]) == signatureMagic {
+		version = binary.BigEndian.Uint32(head[4:])
+	}
+
+	h, chunks, err := readSignature(r, size)
+	if err != nil && version == 1 {
+		// Any file that does not start with a magic could be version 1 signature
+		return nil, fmt.Errorf("file is not a signature or delta: %s", err.Error())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+
+	// Header is checked when signature is read
+	sh, _ := h.hashParams.strongHash()
+	a, _ := h.chunkParams.chunkAlgorithm()
+	var info = &signatureInfo{
+		Type:       "signature",
+		Format:     FormatDataDiff,
+		Version:    version,
+		Chunker:    a.name,
+		WindowSize: h.windowSize,
+		MinChunk:   h.minSize,
+		MaxChunk:   h.maxSize,
+		AvgChunk:   h.separator + 1,
+		Hash:       sh.name,
+		HashSize:   int(h.hashParams.size),
+		Checksum:   hex.EncodeToString(h.checksum),
+		ChunkCount: len(chunks),
+		Chunks:     make([]chunkInfo, 0, len(chunks)),
+	}
+
+	switch h.algorithm {
+	case chunkerRabin:
+		info.RabinPolynomial = fmt.Sprintf("0x%x", h.polynomial)
+	case chunkerBuzhash:
+		if seed, ok := h.table.seed(); ok {
+			info.BuzhashSeed = &seed
+		} else {
+			info.BuzhashTable = "custom"
+		}
+	}
+
+	var sizes = make([]uint64, 0, len(chunks))
+	for _, c := range chunks {
+		info.Chunks = append(info.Chunks, chunkInfo{
+			Start:        c.start,
+			Size:         c.size,
+			StopChecksum: c.stopChecksum,
+			Hash:         hex.EncodeToString(c.hash),
+		})
+		info.TotalSize += c.size
+		sizes = append(sizes, c.size)
+	}
+	info.Sizes = newSizeStats(sizes)
+
+	return info, nil
+}
+
+// writeText implements description
+func (s *signatureInfo) writeText(w *bufio.Writer) {
+	fmt.Fprintf(w, "data-diff signature version %d\n", s.Version)
+	fmt.Fprintf(w, "Chunker:             %s\n", s.Chunker)
+	if s.RabinPolynomial != "" {
+		fmt.Fprintf(w, "Rabin polynomial:    %s\n", s.RabinPolynomial)
+	}
+	if s.BuzhashSeed != nil {
+		fmt.Fprintf(w, "Buzhash table:       default, seed 0x%08x\n", *s.BuzhashSeed)
+	}
+	if s.BuzhashTable != "" {
+		fmt.Fprintf(w, "Buzhash table:       %s\n", s.BuzhashTable)
+	}
+	fmt.Fprintf(w, "Rolling hash window: %d bytes\n", s.WindowSize)
+	fmt.Fprintf(w, "Chunk size limits:   min %d, max %d, average %d\n", s.MinChunk, s.MaxChunk, s.AvgChunk)
+	fmt.Fprintf(w, "Strong hash:         %s, %d bytes\n", s.Hash, s.HashSize)
+	fmt.Fprintf(w, "Basis checksum:      %s\n", valueOrNone(s.Checksum))
+	fmt.Fprintf(w, "Chunks:              %d, %d bytes\n", s.ChunkCount, s.TotalSize)
+
+	if s.ChunkCount > 0 {
+		fmt.Fprintf(w, "Chunk sizes:         min %d, max %d, mean %.1f\n", s.Sizes.Min, s.Sizes.Max, s.Sizes.Mean)
+		for _, b := range s.Sizes.Histogram {
+			fmt.Fprintf(w, "  %10d - %-10d %d\n", b.From, b.To, b.Count)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%8s %12s %10s %12s  %s\n", "#", "start", "size", "checksum", "hash")
+	for i, c := range s.Chunks {
+		fmt.Fprintf(w, "%8d %12d %10d %12d  %s\n", i, c.Start, c.Size, c.StopChecksum, c.Hash)
+	}
+}
+
+// rdiffSignatureInfo describes librsync signature
+type rdiffSignatureInfo struct {
+	Type       string      `json:"type"`
+	Format     string      `json:"format"`
+	Magic      string      `json:"magic"`
+	Hash       string      `json:"hash"`
+	HashSize   int         `json:"hashSize"`
+	BlockSize  int         `json:"blockSize"`
+	BlockCount int         `json:"blockCount"`
+	Blocks     []blockInfo `json:"blocks"`
+}
+
+// blockInfo describes block of librsync signature
+type blockInfo struct {
+	Start  uint64 `json:"start"`
+	Weak   uint32 `json:"weak"`
+	Strong string `json:"strong"`
+}
+
+// inspectRdiffSignature reads librsync signature from r
+func inspectRdiffSignature(r io.Reader) (*rdiffSignatureInfo, error) {
+	p, blocks, err := readRdiffSignature(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info = &rdiffSignatureInfo{
+		Type:       "signature",
+		Format:     FormatRdiff,
+		Magic:      fmt.Sprintf("0x%08x", p.magic),
+		Hash:       "blake2b",
+		HashSize:   p.strongLen,
+		BlockSize:  p.blockLen,
+		BlockCount: len(blocks),
+		Blocks:     make([]blockInfo, 0, len(blocks)),
+	}
+	if p.magic == RS_MD4_SIG_MAGIC {
+		info.Hash = "md4"
+	}
+
+	for i, b := range blocks {
+		info.Blocks = append(info.Blocks, blockInfo{
+			Start:  uint64(i) * uint64(p.blockLen),
+			Weak:   b.weak,
+			Strong: hex.EncodeToString(b.strong),
+		})
+	}
+
+	return info, nil
+}
+
+// writeText implements description
+func (s *rdiffSignatureInfo) writeText(w *bufio.Writer) {
+	fmt.Fprintf(w, "rdiff signature, magic %s\n", s.Magic)
+	fmt.Fprintf(w, "Strong hash: %s, %d bytes\n", s.Hash, s.HashSize)
+	fmt.Fprintf(w, "Block size:  %d bytes\n", s.BlockSize)
+	fmt.Fprintf(w, "Blocks:      %d\n", s.BlockCount)
+
+	fmt.Fprintf(w, "\n%8s %12s %10s  %s\n", "#", "start", "weak", "strong")
+	for i, b := range s.Blocks {
+		fmt.Fprintf(w, "%8d %12d 0x%08x  %s\n", i, b.Start, b.Weak, b.Strong)
+	}
+}
+
+// deltaInfo describes delta
+type deltaInfo struct {
+	Type   string `json:"type"`
+	Format string `json:"format"`
+
+	// Checksums of basis and new file or empty if delta has none
+	BasisChecksum   string `json:"basisChecksum,omitempty"`
+	NewFileChecksum string `json:"newFileChecksum,omitempty"`
+
+	// WindowCount is the number of VCDIFF windows
+	WindowCount int `json:"windowCount,omitempty"`
+
+	CopyCount    int    `json:"copyCount"`
+	CopyBytes    uint64 `json:"copyBytes"`
+	LiteralCount int    `json:"literalCount"`
+	LiteralBytes uint64 `json:"literalBytes"`
+	NewFileSize  uint64 `json:"newFileSize"`
+
+	Commands []commandInfo `json:"commands"`
+}
+
+// commandInfo describes delta command
+type commandInfo struct {
+	Command string `json:"command"`
+
+	// Offset of command's data in new file
+	Offset uint64 `json:"offset"`
+
+	// Start of copied data in basis file. VCDIFF copies of earlier new file data have no start.
+	Start *uint64 `json:"start,omitempty"`
+
+	Length uint64 `json:"length"`
+}
+
+// inspectDelta reads rdiff delta and its checksum trailer from r
+func inspectDelta(r *bufio.Reader) (*deltaInfo, error) {
+	err := readDeltaMagic(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info = &deltaInfo{
+		Type:     "delta",
+		Format:   FormatRdiff,
+		Commands: []commandInfo{},
+	}
+
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch cmd.op {
+		case RS_OP_END:
+			sums, err := readChecksums(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s file: %s", argDelta, err.Error())
+			}
+			if sums.basis != nil || sums.newFile != nil {
+				info.Format = FormatDataDiff
+			}
+			info.BasisChecksum = hex.EncodeToString(sums.basis)
+			info.NewFileChecksum = hex.EncodeToString(sums.newFile)
+
+			return info, nil
+		case RS_OP_LITERAL_1:
+			n, err := io.CopyN(io.Discard, r, int64(cmd.length))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read LITERAL data (%d of %d bytes): %s", n, cmd.length, err.Error())
+			}
+
+			info.Commands = append(info.Commands, commandInfo{
+				Command: "LITERAL",
+				Offset:  info.NewFileSize,
+				Length:  cmd.length,
+			})
+			info.LiteralCount++
+			info.LiteralBytes += cmd.length
+		case RS_OP_COPY_N1_N1:
+			start := cmd.start
+			info.Commands = append(info.Commands, commandInfo{
+				Command: "COPY",
+				Offset:  info.NewFileSize,
+				Start:   &start,
+				Length:  cmd.length,
+			})
+			info.CopyCount++
+			info.CopyBytes += cmd.length
+		}
+
+		info.NewFileSize += cmd.length
+	}
+}
+
+// inspectVcdiffDelta reads VCDIFF delta from r. ADD and RUN instructions are counted as literals.
+func inspectVcdiffDelta(r *bufio.Reader) (*deltaInfo, error) {
+	err := readVcdiffHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info = &deltaInfo{
+		Type:     "delta",
+		Format:   FormatVcdiff,
+		Commands: []commandInfo{},
+	}
+
+	for {
+		w, err := readVcdiffWindow(r)
+		if err == io.EOF {
+			return info, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		info.WindowCount++
+
+		err = w.decode(func(in vcdiffInstruction) error {
+			var c = commandInfo{Offset: info.NewFileSize, Length: in.size}
+			switch in.inst {
+			case VCD_ADD, VCD_RUN:
+				c.Command = "ADD"
+				if in.inst == VCD_RUN {
+					c.Command = "RUN"
+				}
+				info.LiteralCount++
+				info.LiteralBytes += in.size
+			case VCD_COPY:
+				c.Command = "COPY"
+				if in.addr < w.srcLen {
+					start := w.srcPos + in.addr
+					c.Start = &start
+				}
+				info.CopyCount++
+				info.CopyBytes += in.size
+			}
+
+			info.Commands = append(info.Commands, c)
+			info.NewFileSize += in.size
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// inspectBsdiffDelta reads BSDIFF40 delta from r. Diff bytes are counted as copies and extra bytes as literals.
+func inspectBsdiffDelta(r *bufio.Reader) (*deltaInfo, error) {
+	br, err := newBsdiffReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var info = &deltaInfo{
+		Type:     "delta",
+		Format:   FormatBsdiff,
+		Commands: []commandInfo{},
+	}
+
+	var oldPos int64
+	for int64(info.NewFileSize) < br.newSize {
+		c, err := br.next(int64(info.NewFileSize))
+		if err != nil {
+			return nil, err
+		}
+
+		if c.diff > 0 {
+			var cmd = commandInfo{Command: "DIFF", Offset: info.NewFileSize, Length: uint64(c.diff)}
+			if oldPos >= 0 {
+				start := uint64(oldPos)
+				cmd.Start = &start
+			}
+			info.Commands = append(info.Commands, cmd)
+			info.CopyCount++
+			info.CopyBytes += uint64(c.diff)
+			info.NewFileSize += uint64(c.diff)
+		}
+
+		if c.extra > 0 {
+			info.Commands = append(info.Commands, commandInfo{
+				Command: "EXTRA",
+				Offset:  info.NewFileSize,
+				Length:  uint64(c.extra),
+			})
+			info.LiteralCount++
+			info.LiteralBytes += uint64(c.extra)
+			info.NewFileSize += uint64(c.extra)
+		}
+
+		oldPos += c.diff + c.seek
+	}
+
+	return info, nil
+}
+
+// writeText implements description
+func (d *deltaInfo) writeText(w *bufio.Writer) {
+	fmt.Fprintf(w, "%s delta\n", d.Format)
+	if d.Format == FormatDataDiff {
+		fmt.Fprintf(w, "Basis checksum:    %s\n", valueOrNone(d.BasisChecksum))
+		fmt.Fprintf(w, "New file checksum: %s\n", valueOrNone(d.NewFileChecksum))
+	}
+	if d.Format == FormatVcdiff {
+		fmt.Fprintf(w, "Windows:           %d\n", d.WindowCount)
+	}
+	fmt.Fprintf(w, "Copies:            %d, %d bytes\n", d.CopyCount, d.CopyBytes)
+	fmt.Fprintf(w, "Literals:          %d, %d bytes\n", d.LiteralCount, d.LiteralBytes)
+	fmt.Fprintf(w, "New file size:     %d bytes\n", d.NewFileSize)
+
+	fmt.Fprintf(w, "\n%12s %-8s %12s %10s\n", "offset", "command", "start", "length")
+	for _, c := range d.Commands {
+		if c.Start != nil {
+			fmt.Fprintf(w, "%12d %-8s %12d %10d\n", c.Offset, c.Command, *c.Start, c.Length)
+		} else {
+			fmt.Fprintf(w, "%12d %-8s %12s %10d\n", c.Offset, c.Command, "", c.Length)
+		}
+	}
+}
+
+// valueOrNone returns s or "none" if s is empty
+func valueOrNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+
+	return s
+}
@@ -0,0 +1,272 @@
+package datadiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectDelta(t *testing.T) {
+	var delta = joinChunks(RS_DELTA_MAGIC, "\x05hello", "\x45\x0a\x03", "\x00")
+
+	out := &bytes.Buffer{}
+	err := Inspect(bytes.NewReader(delta), out, InspectOptions{})
+	assert.NoError(t, err, "Inspect should not return error")
+	assert.Equal(t, `rdiff delta
+Copies:            1, 3 bytes
+Literals:          1, 5 bytes
+New file size:     8 bytes
+
+      offset command         start     length
+           0 LITERAL                        5
+           5 COPY               10          3
+`, out.String(), "Delta commands should be described")
+
+	out.Reset()
+	err = Inspect(bytes.NewReader(delta), out, InspectOptions{JSON: true})
+	assert.NoError(t, err, "Inspect should not return error")
+	assert.JSONEq(t, `{
+		"type": "delta",
+		"format": "rdiff",
+		"copyCount": 1,
+		"copyBytes": 3,
+		"literalCount": 1,
+		"literalBytes": 5,
+		"newFileSize": 8,
+		"commands": [
+			{"command": "LITERAL", "offset": 0, "length": 5},
+			{"command": "COPY", "offset": 5, "start": 10, "length": 3}
+		]
+	}`, out.String(), "Delta should be described as JSON")
+}
+
+func TestInspectDeltaChecksums(t *testing.T) {
+	var data = []byte(strings.Repeat("Inspected data. ", 100))
+
+	sig := &bytes.Buffer{}
+	err := Signature(bytes.NewReader(data), sig, SignatureOptions{})
+	assert.NoError(t, err, "Signature should not return error")
+
+	delta := &bytes.Buffer{}
+	err = Delta(sig, bytes.NewReader(data), delta, DeltaOptions{})
+	assert.NoError(t, err, "Delta should not return error")
+
+	var got deltaInfo
+	out := &bytes.Buffer{}
+	err = Inspect(delta, out, InspectOptions{JSON: true})
+	assert.NoError(t, err, "Inspect should not return error")
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &got), "Output should be JSON")
+
+	assert.Equal(t, FormatDataDiff, got.Format, "Delta with checksums should be data-diff delta")
+	assert.Len(t, got.BasisChecksum, 64, "Delta should have basis checksum")
+	assert.Equal(t, got.BasisChecksum, got.NewFileChecksum, "Checksums of equal files should be equal")
+	assert.Equal(t, uint64(len(data)), got.NewFileSize, "New file size should be sum of commands")
+}
+
+func TestInspectVcdiffDelta(t *testing.T) {
+	delta := &bytes.Buffer{}
+	dw := NewVcdiffDelta(delta)
+	dw.AddLiteral([]byte("hello"))
+	dw.AddLiteral(bytes.Repeat([]byte("!"), 10))
+	dw.AddCopy(100, 20)
+	assert.NoError(t, dw.Close(), "Close should not return error")
+
+	// Copy from target window has no basis start
+	delta.WriteString(vcdiffWindowBytes("\x00", 8, "", "ab", "\x03\x16", "\x00"))
+
+	out := &bytes.Buffer{}
+	err := Inspect(bytes.NewReader(delta.Bytes()), out, InspectOptions{})
+	assert.NoError(t, err, "Inspect should not return error")
+	assert.Equal(t, `vcdiff delta
+Windows:           2
+Copies:            2, 26 bytes
+Literals:          3, 17 bytes
+New file size:     43 bytes
+
+      offset command         start     length
+           0 ADD                            5
+           5 RUN                           10
+          15 COPY              100         20
+          35 ADD                            2
+          37 COPY                           6
+`, out.String(), "VCDIFF instructions should be described")
+}
+
+func TestInspectBsdiffDelta(t *testing.T) {
+	// Diff before the start of basis has no basis start
+	delta := bsdiffBytes(12,
+		bsdiffControls(3, 2, -10, 4, 0, 3, 3, 0, 0),
+		"\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00",
+		"ab")
+
+	out := &bytes.Buffer{}
+	err := Inspect(bytes.NewReader(delta), out, InspectOptions{})
+	assert.NoError(t, err, "Inspect should not return error")
+	assert.Equal(t, `bsdiff delta
+Copies:            3, 10 bytes
+Literals:          1, 2 bytes
+New file size:     12 bytes
+
+      offset command         start     length
+           0 DIFF                0          3
+           3 EXTRA                          2
+           5 DIFF                           4
+           9 DIFF                0          3
+`, out.String(), "BSDIFF40 controls should be described")
+}
+
+func TestInspectSignature(t *testing.T) {
+	var data = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(7)).Read(data)
+
+	sig := &bytes.Buffer{}
+	err := Signature(bytes.NewReader(data), sig, SignatureOptions{Hash: "sha256", HashSize: 8})
+	assert.NoError(t, err, "Signature should not return error")
+
+	var got signatureInfo
+	out := &bytes.Buffer{}
+	err = Inspect(bytes.NewReader(sig.Bytes()), out, InspectOptions{JSON: true})
+	assert.NoError(t, err, "Inspect should not return error")
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &got), "Output should be JSON")
+
+	assert.Equal(t, uint32(4), got.Version, "Signature version should be described")
+	assert.Equal(t, ChunkerPolynomial, got.Chunker, "Chunker should be described")
+	assert.Equal(t, "sha256", got.Hash, "Strong hash should be described")
+	assert.Equal(t, 8, got.HashSize, "Hash size should be described")
+	assert.Equal(t, uint64(128), got.AvgChunk, "Average chunk size should be described")
+	assert.Len(t, got.Checksum, 64, "Basis checksum should be described")
+	assert.Equal(t, uint64(len(data)), got.TotalSize, "Chunks should cover the basis file")
+	assert.Len(t, got.Chunks, got.ChunkCount, "Each chunk should be described")
+
+	var counted int
+	for _, b := range got.Sizes.Histogram {
+		counted += b.Count
+	}
+	assert.Equal(t, got.ChunkCount, counted, "Histogram should count each chunk")
+	assert.Equal(t, uint64(32), got.Sizes.Min, "Smallest chunk should be minimum size")
+	assert.Equal(t, uint64(1024), got.Sizes.Max, "Largest chunk should be maximum size")
+
+	out.Reset()
+	err = Inspect(bytes.NewReader(sig.Bytes()), out, InspectOptions{})
+	assert.NoError(t, err, "Inspect should not return error")
+	assert.Contains(t, out.String(), "Strong hash:         sha256, 8 bytes\n", "Text should describe header")
+	assert.Contains(t, out.String(), "\n          32 - 63         ", "Text should have size distribution")
+}
+
+func TestInspectChunkerParams(t *testing.T) {
+	var data = []byte(strings.Repeat("Chunked data. ", 100))
+
+	var seed = uint32(0xbeef)
+	var tests = []struct {
+		opts     SignatureOptions
+		expected signatureInfo
+		text     string
+	}{
+		{
+			opts:     SignatureOptions{Chunker: ChunkerRabin},
+			expected: signatureInfo{Chunker: ChunkerRabin, WindowSize: 64, RabinPolynomial: "0x3da3358b4dc173"},
+			text:     "Rabin polynomial:    0x3da3358b4dc173\n",
+		},
+		{
+			opts:     SignatureOptions{Chunker: ChunkerBuzhash, BuzhashSeed: seed},
+			expected: signatureInfo{Chunker: ChunkerBuzhash, WindowSize: 48, BuzhashSeed: &seed},
+			text:     "Buzhash table:       default, seed 0x0000beef\n",
+		},
+		{
+			opts:     SignatureOptions{Chunker: ChunkerBuzhash, BuzhashTable: make([]uint32, 256)},
+			expected: signatureInfo{Chunker: ChunkerBuzhash, WindowSize: 48, BuzhashTable: "custom"},
+			text:     "Buzhash table:       custom\n",
+		},
+	}
+
+	for _, tt := range tests {
+		sig := &bytes.Buffer{}
+		err := Signature(bytes.NewReader(data), sig, tt.opts)
+		assert.NoError(t, err, "Signature should not return error")
+
+		var got signatureInfo
+		out := &bytes.Buffer{}
+		err = Inspect(bytes.NewReader(sig.Bytes()), out, InspectOptions{JSON: true})
+		assert.NoError(t, err, "Inspect should not return error")
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &got), "Output should be JSON")
+
+		assert.Equal(t, tt.expected.Chunker, got.Chunker, "Chunker should be described")
+		assert.Equal(t, tt.expected.WindowSize, got.WindowSize, "Window size should be described")
+		assert.Equal(t, tt.expected.RabinPolynomial, got.RabinPolynomial, "Rabin polynomial should be described")
+		assert.Equal(t, tt.expected.BuzhashSeed, got.BuzhashSeed, "Buzhash seed should be described")
+		assert.Equal(t, tt.expected.BuzhashTable, got.BuzhashTable, "Buzhash table should be described")
+
+		out.Reset()
+		err = Inspect(bytes.NewReader(sig.Bytes()), out, InspectOptions{})
+		assert.NoError(t, err, "Inspect should not return error")
+		assert.Contains(t, out.String(), tt.text, "Text should describe rolling hash parameters")
+	}
+}
+
+func TestInspectFormats(t *testing.T) {
+	rdiffSig := &bytes.Buffer{}
+	err := Signature(strings.NewReader(strings.Repeat("x", 5000)), rdiffSig, SignatureOptions{Format: FormatRdiff})
+	assert.NoError(t, err, "Signature should not return error")
+
+	var tests = []struct {
+		name         string
+		data         []byte
+		expectedHead string
+		expectedErr  string
+	}{
+		{
+			name:         "Version 1 signature",
+			data:         signature,
+			expectedHead: "data-diff signature version 1\n",
+		},
+		{
+			name:         "Version 2 signature",
+			data:         signatureNoHeader(signature),
+			expectedHead: "data-diff signature version 2\n",
+		},
+		{
+			name:         "Rdiff signature",
+			data:         rdiffSig.Bytes(),
+			expectedHead: "rdiff signature, magic 0x72730137\nStrong hash: blake2b, 32 bytes\nBlock size:  2048 bytes\nBlocks:      3\n",
+		},
+		{
+			name:        "Unknown file",
+			data:        []byte("Not a signature"),
+			expectedErr: "file is not a signature or delta: signature of 1315927072 chunks has to be 47373374592 bytes long, remaining size is 11",
+		},
+		{
+			name:        "Truncated signature",
+			data:        signatureHeaderBytes(newSignatureHeader(defaultChunkParams, defaultHashParams)),
+			expectedErr: "invalid signature: failed to read [0] chunk start: EOF",
+		},
+		{
+			name:        "Truncated delta",
+			data:        joinChunks(RS_DELTA_MAGIC, "\x05abc"),
+			expectedErr: "failed to read LITERAL data (3 of 5 bytes): EOF",
+		},
+		{
+			name:        "Literal length overflows",
+			data:        joinChunks(RS_DELTA_MAGIC, "\x44\xff\xff\xff\xff\xff\xff\xff\xffabc"),
+			expectedErr: "invalid DELTA file: LITERAL length 18446744073709551615 is too large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := Inspect(bytes.NewReader(tt.data), out, InspectOptions{})
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "Inspect should not return error")
+			assert.True(t, strings.HasPrefix(out.String(), tt.expectedHead), "Description should start with\n%s\ngot\n%s", tt.expectedHead, out.String())
+		})
+	}
+}
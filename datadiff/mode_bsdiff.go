@@ -0,0 +1,183 @@
+package datadiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// bsdiffMinGain is how many more bytes a new match has to match than the current alignment before bsdiff switches to
+// it
+const bsdiffMinGain = 8
+
+// createBsdiff reads whole basis and newFile and writes delta of newFile against basis to deltaB which is closed at
+// the end. Matches are searched from suffix array of basis and extended to approximate matches like bsdiff does, so
+// data with small scattered changes like relocated addresses of executables is written as mostly zero differences.
+func createBsdiff(basis, newFile io.Reader, deltaB diffDeltaBuffer, opts DiffOptions) error {
+	var log = newLogger(opts.Log)
+
+	basisData, err := io.ReadAll(basis)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %s", argOldFile, err.Error())
+	}
+	if int64(len(basisData)) > suffixSortMaxSize {
+		return fmt.Errorf("%s file is too large to diff: %d bytes, use signature and delta instead", argOldFile,
+			len(basisData))
+	}
+
+	newData, err := io.ReadAll(newFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %s", argNewFile, err.Error())
+	}
+
+	log.println()
+	log.println("Finding differences:")
+	log.println()
+
+	d := &bsdiffIndex{basis: basisData, sa: suffixSort(basisData)}
+	d.match(newData, deltaB, log)
+
+	err = deltaB.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write %s file: %s", argDelta, err.Error())
+	}
+
+	return nil
+}
+
+// bsdiffIndex finds longest matches from basis by binary search of its suffix array
+type bsdiffIndex struct {
+	basis []byte
+	sa    []int32
+}
+
+// longestMatch returns basis position and length of the longest match of data start
+func (d *bsdiffIndex) longestMatch(data []byte) (pos, length int) {
+	var st, en = 0, len(d.sa) - 1
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		suffix := d.basis[d.sa[x]:]
+
+		var n = len(suffix)
+		if len(data) < n {
+			n = len(data)
+		}
+		if bytes.Compare(suffix[:n], data[:n]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+
+	x := commonPrefix(d.basis[d.sa[st]:], data)
+	y := commonPrefix(d.basis[d.sa[en]:], data)
+	if x > y {
+		return int(d.sa[st]), x
+	}
+
+	return int(d.sa[en]), y
+}
+
+// match writes delta of newData to deltaB. Each exact match found from basis is extended forwards and backwards as
+// long as more than half of bytes match, and the extended regions are written as differences to basis data.
+func (d *bsdiffIndex) match(newData []byte, deltaB diffDeltaBuffer, log *logger) {
+	var old = d.basis
+	var oldSize, newSize = len(old), len(newData)
+
+	var scan, pos, length int
+	var lastScan, lastPos, lastOffset int
+	var diff []byte
+	var matches int
+
+	for scan < newSize {
+		// Exact matches are searched until one is better than continuing the previous match with differences.
+		// Score of previous match counts the bytes that match at its offset.
+		var oldScore int
+		scan += length
+		for scsc := scan; scan < newSize; scan++ {
+			pos, length = d.longestMatch(newData[scan:])
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < oldSize && old[scsc+lastOffset] == newData[scsc] {
+					oldScore++
+				}
+			}
+
+			if length == oldScore && length != 0 || length > oldScore+bsdiffMinGain {
+				break
+			}
+
+			if scan+lastOffset < oldSize && old[scan+lastOffset] == newData[scan] {
+				oldScore--
+			}
+		}
+
+		if length == oldScore && scan != newSize {
+			continue
+		}
+
+		// Previous match is extended forwards and the new match backwards while more than half of bytes match
+		var lenf int
+		var s, sf int
+		for i := 0; lastScan+i < scan && lastPos+i < oldSize; {
+			if old[lastPos+i] == newData[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf, lenf = s, i
+			}
+		}
+
+		var lenb int
+		if scan < newSize {
+			var s, sb int
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == newData[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb, lenb = s, i
+				}
+			}
+		}
+
+		// Overlapping extensions are split where the most bytes match
+		if lastScan+lenf > scan-lenb {
+			overlap := (lastScan + lenf) - (scan - lenb)
+			var s, ss, lens int
+			for i := 0; i < overlap; i++ {
+				if newData[lastScan+lenf-overlap+i] == old[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if newData[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss, lens = s, i+1
+				}
+			}
+
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		diff = diff[:0]
+		for i := 0; i < lenf; i++ {
+			diff = append(diff, newData[lastScan+i]-old[lastPos+i])
+		}
+		deltaB.addDiff(uint64(lastPos), diff)
+
+		extra := newData[lastScan+lenf : scan-lenb]
+		if len(extra) > 0 {
+			deltaB.AddLiteral(extra)
+		}
+
+		log.println(matches, "differs from basefile at:", lastPos, "Length:", lenf, "Extra:", len(extra))
+
+		matches++
+		lastScan = scan - lenb
+		lastPos = pos - lenb
+		lastOffset = pos - scan
+	}
+}
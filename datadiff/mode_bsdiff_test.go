@@ -0,0 +1,146 @@
+package datadiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// relocated returns data with every 64th 4 byte little endian integer increased by offset, like addresses of
+// executable change when code before them grows
+func relocated(data []byte, offset uint32) []byte {
+	var r = append([]byte(nil), data...)
+	for i := 0; i+4 <= len(r); i += 64 {
+		binary.LittleEndian.PutUint32(r[i:], binary.LittleEndian.Uint32(r[i:])+offset)
+	}
+	return r
+}
+
+func TestBsdiff(t *testing.T) {
+	var basis = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(16)).Read(basis)
+
+	var inserted = append(append(append([]byte(nil), basis[:1000]...), "inserted"...), basis[1000:]...)
+
+	var tests = []struct {
+		name        string
+		basis       []byte
+		newFile     []byte
+		expectedMax int
+	}{
+		{
+			name:        "Equal files",
+			basis:       basis,
+			newFile:     basis,
+			expectedMax: 200,
+		},
+		{
+			name:        "Relocated addresses",
+			basis:       basis,
+			newFile:     relocated(basis, 0x1000),
+			expectedMax: 2000,
+		},
+		{
+			name:        "Inserted and relocated",
+			basis:       basis,
+			newFile:     relocated(inserted, 8),
+			expectedMax: 2000,
+		},
+		{
+			name:        "Repeated data",
+			basis:       []byte(strings.Repeat("abc", 1000)),
+			newFile:     []byte(strings.Repeat("abc", 3000) + "d"),
+			expectedMax: 200,
+		},
+		{
+			name:        "Empty basis",
+			newFile:     []byte("new file"),
+			expectedMax: 200,
+		},
+		{
+			name:        "Empty new file",
+			basis:       basis,
+			expectedMax: 200,
+		},
+		{
+			name:        "Short files",
+			basis:       []byte("abc"),
+			newFile:     []byte("ab"),
+			expectedMax: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := &bytes.Buffer{}
+			err := Diff(bytes.NewReader(tt.basis), bytes.NewReader(tt.newFile), delta, DiffOptions{Format: FormatBsdiff})
+			assert.NoError(t, err, "Diff should not return error")
+			assert.LessOrEqual(t, delta.Len(), tt.expectedMax, "Delta should mostly consist of zero differences")
+
+			got := &bytes.Buffer{}
+			err = Patch(bytes.NewReader(tt.basis), delta, got, PatchOptions{})
+			assert.NoError(t, err, "Patch should not return error")
+			assert.True(t, bytes.Equal(tt.newFile, got.Bytes()), "Patched data should equal to new file")
+		})
+	}
+}
+
+func TestBsdiffSmallerThanDiff(t *testing.T) {
+	var basis = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(17)).Read(basis)
+
+	var modified = relocated(basis, 0x40)
+
+	diff := &bytes.Buffer{}
+	err := Diff(bytes.NewReader(basis), bytes.NewReader(modified), diff, DiffOptions{})
+	assert.NoError(t, err, "Diff should not return error")
+
+	bsdiff := &bytes.Buffer{}
+	err = Diff(bytes.NewReader(basis), bytes.NewReader(modified), bsdiff, DiffOptions{Format: FormatBsdiff})
+	assert.NoError(t, err, "Diff should not return error")
+
+	assert.Less(t, bsdiff.Len(), diff.Len()/10, "Bsdiff should write scattered changes as compressible differences")
+}
+
+func TestBsdiffLongestMatch(t *testing.T) {
+	var basis = []byte("0123456789abcdef0123xyz")
+	var d = &bsdiffIndex{basis: basis, sa: suffixSort(basis)}
+
+	var tests = []struct {
+		data           string
+		expectedPos    int
+		expectedLength int
+	}{
+		{data: "0123456", expectedPos: 0, expectedLength: 7},
+		{data: "0123x", expectedPos: 16, expectedLength: 5},
+		{data: "defg", expectedPos: 13, expectedLength: 3},
+		{data: "xyz!", expectedPos: 20, expectedLength: 3},
+		{data: "!", expectedLength: 0},
+	}
+
+	for _, tt := range tests {
+		pos, length := d.longestMatch([]byte(tt.data))
+		assert.Equal(t, tt.expectedLength, length, "Match length of %s should be as expected", tt.data)
+		if tt.expectedLength > 0 {
+			assert.Equal(t, tt.expectedPos, pos, "Match of %s should be found", tt.data)
+		}
+	}
+}
+
+func BenchmarkBsdiff(b *testing.B) {
+	var basis = make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(basis)
+
+	var modified = relocated(basis, 0x1000)
+
+	b.SetBytes(int64(len(modified)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		Diff(bytes.NewReader(basis), bytes.NewReader(modified), &bytes.Buffer{}, DiffOptions{Format: FormatBsdiff})
+	}
+}
@@ -0,0 +1,282 @@
+package datadiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// DeltaBuffer represents buffer that contains the delta of basis and changed file
+type DeltaBuffer interface {
+	// Close writes the remaining commands to underlying writer. Write errors are returned here.
+	Close() error
+
+	// AddLiteral writes literal command to buffer
+	AddLiteral(data []byte)
+
+	// AddCopy writes copy command to buffer
+	AddCopy(start, length uint64)
+}
+
+// createDelta processes signature and newfile to create delta which contains changes between new file and basis file
+// from which the signature was created. Delta commands are written to deltaB which is closed at the end. With
+// opts.ByteMatch basis chunks are searched at every offset of new file instead of comparing chunks of new file.
+//
+// Signature can also be librsync signature in which case basis blocks are searched at every offset of new file.
+// Unless delta format is rdiff, checksums of basis and new file follow the END command when deltaB supports it.
+func createDelta(signature, newFile io.Reader, deltaB DeltaBuffer, opts DeltaOptions) error {
+	var log = newLogger(opts.Log)
+	var sigSize = remainingSize(signature)
+	var sigReader = bufio.NewReader(signature)
+
+	// Whole new file is hashed while it is read
+	var h = newFileHash()
+	newFile = io.TeeReader(newFile, h)
+
+	var sums fileChecksums
+	var format = opts.Format
+
+	// Error is noticed when the signature is read
+	head, _ := sigReader.Peek(4)
+	if isRdiffSignature(head) {
+		if format == "" {
+			format = FormatRdiff
+		}
+
+		err := createBlockDelta(sigReader, newFile, deltaB, log)
+		if err != nil {
+			return err
+		}
+	} else {
+		header, chunks, err := readSignature(sigReader, sigSize)
+		if err != nil {
+			// Typed signature errors are matched through the wrapping error
+			return fmt.Errorf("failed to read %s file: %w", argSignature, err)
+		}
+		sums.basis = header.checksum
+
+		// Chunks are resolved and compared with the parameters of signature
+		c, err := newChunker(header.chunkParams, header.hashParams, opts.Jobs, log)
+		if err != nil {
+			return fmt.Errorf("failed to read %s file: %s", argSignature, err.Error())
+		}
+
+		log.println()
+		log.println("Finding differences:")
+		log.println()
+
+		if opts.ByteMatch {
+			err = matchBytes(newFile, chunks, c, deltaB)
+		} else {
+			err = matchChunks(newFile, chunks, c, deltaB)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s file: %s", argNewFile, err.Error())
+		}
+	}
+
+	sums.newFile = h.Sum(nil)
+	err := closeDelta(deltaB, format, sums)
+	if err != nil {
+		return fmt.Errorf("failed to write %s file: %s", argDelta, err.Error())
+	}
+
+	return nil
+}
+
+// closeDelta closes deltaB. Unless format is rdiff, checksums follow the END command when deltaB supports it.
+func closeDelta(deltaB DeltaBuffer, format string, sums fileChecksums) error {
+	if cw, ok := deltaB.(checksumDeltaBuffer); ok && format != FormatRdiff {
+		return cw.closeWithChecksums(sums)
+	}
+
+	return deltaB.Close()
+}
+
+// checksumDeltaBuffer is DeltaBuffer that can write checksum trailer after the delta commands
+type checksumDeltaBuffer interface {
+	DeltaBuffer
+
+	// closeWithChecksums closes the buffer like Close and writes checksums after the END command
+	closeWithChecksums(c fileChecksums) error
+}
+
+// matchChunks resolves chunks of newFile and writes copy command for chunks found from basis chunks
+func matchChunks(newFile io.Reader, chunks []chunk, ch *chunker, deltaB DeltaBuffer) error {
+	var index = newChunkIndex(chunks)
+
+	var i int
+	return ch.resolve(newFile, func(newChunk chunk, data []byte) error {
+		if c := index.find(&newChunk); c != nil {
+			deltaB.AddCopy(c.start, c.size)
+
+			ch.log.println(i, "matches chunk in basefile:", c.number)
+		} else {
+			deltaB.AddLiteral(data)
+			if ch.log.enabled() {
+				ch.log.println(i, "No matching chunk in basefile. Content:", "\""+string(data)+"\"")
+			}
+		}
+
+		i++
+		return nil
+	})
+}
+
+// chunkKeySize fits stopChecksum and the largest hash, as hash size is stored in one byte
+const chunkKeySize = 8 + math.MaxUint8
+
+// chunkIndex finds basis chunks by their stopChecksum and hash
+type chunkIndex map[string]*chunk
+
+// newChunkIndex indexes chunks. If several chunks have the same content, the first one is used.
+func newChunkIndex(chunks []chunk) chunkIndex {
+	var ci = make(chunkIndex, len(chunks))
+
+	// Iterate backwards so that the first of equal chunks remains
+	for j := len(chunks) - 1; j >= 0; j-- {
+		var key [chunkKeySize]byte
+		ci[string(chunkKey(key[:], &chunks[j]))] = &chunks[j]
+	}
+
+	return ci
+}
+
+// find returns basis chunk with same content as c or nil if there is none
+func (ci chunkIndex) find(c *chunk) *chunk {
+	var key [chunkKeySize]byte
+	return ci[string(chunkKey(key[:], c))]
+}
+
+// chunkKey writes index key of c to key. Key buffer has to fit stopChecksum and hash of c.
+func chunkKey(key []byte, c *chunk) []byte {
+	binary.BigEndian.PutUint64(key, c.stopChecksum)
+	return key[:8+copy(key[8:], c.hash)]
+}
+
+// createBlockDelta writes delta commands of newFile against basis file of librsync signature to deltaB
+func createBlockDelta(signature, newFile io.Reader, deltaB DeltaBuffer, log *logger) error {
+	p, blocks, err := readRdiffSignature(signature)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %s", argSignature, err.Error())
+	}
+
+	log.println()
+	log.println("Finding differences:")
+	log.println()
+
+	err = matchBlocks(newFile, p, blocks, deltaB, log)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %s", argNewFile, err.Error())
+	}
+
+	return nil
+}
+
+// matchBlocks searches basis blocks of librsync signature at every offset of newFile and writes delta commands to
+// deltaB.
+//
+// Rollsum of block sized window is compared to weak sums of blocks and strong sum is calculated only for those
+// candidates. At the end of file the window shrinks, so that the last block of basis file, which may be shorter, can
+// be matched too.
+func matchBlocks(newFile io.Reader, p rdiffParams, blocks []rdiffBlock, deltaB DeltaBuffer, log *logger) error {
+	var candidates = make(map[uint32][]int)
+	for j := 0; j < len(blocks); j++ {
+		candidates[blocks[j].weak] = append(candidates[blocks[j].weak], j)
+	}
+
+	var h = p.newStrongHash()
+	var strong = make([]byte, 0, h.Size())
+
+	// buf holds the window and unmatched data before it
+	var buf = make([]byte, 0, p.blockLen+chunkReadSize)
+	var pos int // Start of unmatched data in buf
+	var win int // Start of window in buf
+	var rs rollsum
+	var eof bool
+	var matches int
+
+	for !eof {
+		if win > 0 {
+			if pos < win {
+				deltaB.AddLiteral(buf[pos:win])
+			}
+
+			buf = buf[:copy(buf, buf[win:])]
+			pos, win = 0, 0
+		}
+
+		n, err := io.ReadFull(newFile, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			eof = true
+		} else if err != nil {
+			return err
+		}
+
+		for {
+			if int(rs.count) < p.blockLen && win+int(rs.count) < len(buf) {
+				end := win + p.blockLen
+				if end > len(buf) {
+					end = len(buf)
+				}
+				rs.update(buf[win+int(rs.count) : end])
+			}
+
+			end := win + int(rs.count)
+			if !eof && end >= len(buf) {
+				// Window can not be moved before next read
+				break
+			}
+			if rs.count == 0 {
+				break
+			}
+
+			var found = -1
+			if cs, ok := candidates[rs.digest()]; ok {
+				h.Reset()
+				h.Write(buf[win:end])
+				strong = h.Sum(strong[:0])[:p.strongLen]
+
+				for _, j := range cs {
+					if bytes.Equal(strong, blocks[j].strong) {
+						found = j
+						break
+					}
+				}
+			}
+
+			if found >= 0 {
+				if pos < win {
+					deltaB.AddLiteral(buf[pos:win])
+				}
+				deltaB.AddCopy(uint64(found)*uint64(p.blockLen), uint64(rs.count))
+
+				log.println(matches, "matches block in basefile:", found, "Literal before:", win-pos)
+
+				matches++
+				win = end
+				pos = win
+				rs = rollsum{}
+				continue
+			}
+
+			if end < len(buf) {
+				rs.rotate(buf[win], buf[end])
+			} else {
+				// Window shrinks at the end of file
+				rs.rollout(buf[win])
+			}
+			win++
+		}
+	}
+
+	if pos < len(buf) {
+		deltaB.AddLiteral(buf[pos:])
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package datadiff
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// matchBytes searches basis chunks at every offset of newFile like rsync does and writes delta commands to deltaB.
+//
+// Rolling hash of each window of new file is compared to stopChecksum of basis chunks, which is the rolling hash of
+// the chunk's last window. Strong hash of the data ending at the window is calculated only for those candidates. Only
+// data that is not part of any basis chunk becomes literal, also when the chunk boundaries of new file have moved.
+func matchBytes(newFile io.Reader, chunks []chunk, ch *chunker, deltaB DeltaBuffer) error {
+	var p = ch.params
+
+	var candidates = make(map[uint64][]*chunk)
+	for j := 0; j < len(chunks); j++ {
+		candidates[chunks[j].stopChecksum] = append(candidates[chunks[j].stopChecksum], &chunks[j])
+	}
+
+	// Longer chunks are tried first as they produce less commands
+	for _, cs := range candidates {
+		sort.SliceStable(cs, func(a, b int) bool {
+			return cs[a].size > cs[b].size
+		})
+	}
+
+	// buf holds data that can still be part of a match and window-1 bytes preceding unhashed data
+	var buf = make([]byte, 0, p.maxSize+chunkReadSize)
+	var hashes = make([]uint64, 0, cap(buf))
+	var pos int    // Start of unmatched data in buf
+	var hashed int // End of hashed data in buf
+	var matches int
+
+	for {
+		// Matches of next block start after keep, so unmatched data before it is literal
+		keep := hashed - p.maxSize
+		if hashed-(ch.window-1) < keep {
+			keep = hashed - (ch.window - 1)
+		}
+		if keep > 0 {
+			if pos < keep {
+				deltaB.AddLiteral(buf[pos:keep])
+				pos = keep
+			}
+
+			buf = buf[:copy(buf, buf[keep:])]
+			pos -= keep
+			hashed -= keep
+		}
+
+		n, err := io.ReadFull(newFile, buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if n == 0 {
+				break
+			}
+		} else if err != nil {
+			return err
+		}
+
+		// Hash of the first window in segment is for data at buf[hashed]
+		var segment = 0
+		if hashed > 0 {
+			segment = hashed - (ch.window - 1)
+		}
+
+		hashes = ch.rollingHash(buf[segment:], hashes[:0])
+
+		for j := 0; j < len(hashes); j++ {
+			i := segment + ch.window - 1 + j
+
+			for _, c := range candidates[hashes[j]] {
+				if c.size > uint64(i+1-pos) {
+					// Chunk would overlap previous match or the data is no longer in buffer
+					continue
+				}
+
+				start := i + 1 - int(c.size)
+				if !bytes.Equal(ch.hasher.sum(buf[start:i+1]), c.hash) {
+					continue
+				}
+
+				if pos < start {
+					deltaB.AddLiteral(buf[pos:start])
+				}
+				deltaB.AddCopy(c.start, c.size)
+
+				ch.log.println(matches, "matches chunk in basefile:", c.number, "Literal before:", start-pos)
+
+				matches++
+				pos = i + 1
+				break
+			}
+		}
+
+		hashed = len(buf)
+		if len(buf) < cap(buf) {
+			// Reached end of file
+			break
+		}
+	}
+
+	if pos < len(buf) {
+		deltaB.AddLiteral(buf[pos:])
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package datadiff
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchBytes(t *testing.T) {
+	var basis = make([]byte, 4*chunkReadSize)
+	rand.New(rand.NewSource(3)).Read(basis)
+
+	sig := &bytes.Buffer{}
+	err := createSignature(bytes.NewReader(basis), sig, defaultChunkParams, defaultHashParams, 1, nil)
+	assert.NoError(t, err, "createSignature should not return error")
+
+	_, chunks, err := readSignature(bytes.NewReader(sig.Bytes()), int64(sig.Len()))
+	assert.NoError(t, err, "readSignature should not return error")
+
+	// Chunk from the middle of basis
+	var k int
+	for k = 0; chunks[k].start+chunks[k].size <= chunkReadSize; k++ {
+	}
+	c := chunks[k]
+
+	var tests = []struct {
+		name            string
+		modified        []byte
+		expectedLiteral int
+	}{
+		{
+			name:            "Unmodified",
+			modified:        basis,
+			expectedLiteral: 0,
+		},
+		{
+			name: "Chunk separator modified",
+			modified: joinChunks(
+				string(basis[:c.start+c.size-1]),
+				"X",
+				string(basis[c.start+c.size:]),
+			),
+			expectedLiteral: int(c.size),
+		},
+		{
+			name: "Data inserted to chunk",
+			modified: joinChunks(
+				string(basis[:c.start+10]),
+				"Added content",
+				string(basis[c.start+10:]),
+			),
+			expectedLiteral: int(c.size) + len("Added content"),
+		},
+		{
+			name: "Data inserted between chunks",
+			modified: joinChunks(
+				string(basis[:c.start]),
+				"Added content",
+				string(basis[c.start:]),
+			),
+			expectedLiteral: len("Added content"),
+		},
+		{
+			name: "Chunk removed",
+			modified: joinChunks(
+				string(basis[:c.start]),
+				string(basis[c.start+c.size:]),
+			),
+			expectedLiteral: 0,
+		},
+		{
+			name:            "Data added to beginning and end",
+			modified:        joinChunks("Added content", string(basis), "Added content"),
+			expectedLiteral: 2 * len("Added content"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deltaB = new(mockDeltaBuffer)
+
+			err := createDelta(bytes.NewReader(sig.Bytes()), bytes.NewReader(tt.modified), deltaB, DeltaOptions{ByteMatch: true})
+			assert.NoError(t, err, "createDelta should not return error")
+
+			var literal, length int
+			for _, command := range deltaB.commands {
+				literal += len(command.data)
+				length += len(command.data) + int(command.length)
+			}
+
+			assert.Equal(t, tt.expectedLiteral, literal, "Only modified chunks should be literal")
+			assert.Equal(t, len(tt.modified), length, "Commands should cover whole new file")
+		})
+	}
+}
+
+func TestMatchBytesSmallerThanChunkMatch(t *testing.T) {
+	var basis = make([]byte, 4*chunkReadSize)
+	var rnd = rand.New(rand.NewSource(4))
+	rnd.Read(basis)
+
+	// Scattered small edits
+	var modified = append([]byte(nil), basis...)
+	for i := 0; i < 200; i++ {
+		modified[rnd.Intn(len(modified))] ^= 0xff
+	}
+
+	sig := &bytes.Buffer{}
+	err := createSignature(bytes.NewReader(basis), sig, defaultChunkParams, defaultHashParams, 1, nil)
+	assert.NoError(t, err, "createSignature should not return error")
+
+	chunkDelta := &bytes.Buffer{}
+	err = createDelta(bytes.NewReader(sig.Bytes()), bytes.NewReader(modified), NewRdiffDelta(chunkDelta), DeltaOptions{})
+	assert.NoError(t, err, "createDelta should not return error")
+
+	byteDelta := &bytes.Buffer{}
+	err = createDelta(bytes.NewReader(sig.Bytes()), bytes.NewReader(modified), NewRdiffDelta(byteDelta), DeltaOptions{ByteMatch: true})
+	assert.NoError(t, err, "createDelta should not return error")
+
+	assert.Less(t, byteDelta.Len(), chunkDelta.Len(), "Byte matching should create smaller delta")
+
+	got := &bytes.Buffer{}
+	err = applyPatch(bytes.NewReader(basis), byteDelta, got, nil)
+	assert.NoError(t, err, "applyPatch should not return error")
+	assert.True(t, bytes.Equal(modified, got.Bytes()), "Patched data should equal to modified data")
+}
@@ -1,8 +1,10 @@
-package main
+package datadiff
 
 import (
 	"bytes"
 	"encoding/base64"
+	"io"
+	"math/rand"
 	"strings"
 	"testing"
 
@@ -12,7 +14,7 @@ import (
 func TestCreateDelta(t *testing.T) {
 
 	var basisChunks []string
-	chunks, err := readSignature(bytes.NewReader(signature))
+	_, chunks, err := readSignature(bytes.NewReader(signature), int64(len(signature)))
 	if err != nil {
 		panic(err)
 	}
@@ -25,8 +27,6 @@ func TestCreateDelta(t *testing.T) {
 		panic("Wrong amount of chunks in basis file!")
 	}
 
-	//Verbose = true
-
 	// Chunk sizes
 	// 1. 129
 	// 2. 72
@@ -303,13 +303,11 @@ func TestCreateDelta(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var deltaB = new(mockDeltaBuffer)
 
-			deltaBufferConstructor = func() DeltaBuffer {
-				return deltaB
-			}
-
-			_, err := createDelta(
+			err := createDelta(
 				bytes.NewReader(tt.signature),
 				bytes.NewReader(tt.modified),
+				deltaB,
+				DeltaOptions{},
 			)
 
 			assert.NoError(t, err, "createDelta should not return error")
@@ -327,6 +325,84 @@ func TestCreateDelta(t *testing.T) {
 	}
 }
 
+func TestChunkIndex(t *testing.T) {
+	var chunks = []chunk{
+		{start: 0, size: 32, stopChecksum: 1, hash: []byte("aaaa"), number: 0},
+		{start: 32, size: 32, stopChecksum: 2, hash: []byte("bbbb"), number: 1},
+		{start: 64, size: 32, stopChecksum: 1, hash: []byte("aaaa"), number: 2},
+		{start: 96, size: 32, stopChecksum: 1, hash: []byte("bbbb"), number: 3},
+	}
+
+	var index = newChunkIndex(chunks)
+
+	var tests = []struct {
+		name     string
+		chunk    chunk
+		expected *chunk
+	}{
+		{
+			name:     "First of equal chunks is found",
+			chunk:    chunk{stopChecksum: 1, hash: []byte("aaaa")},
+			expected: &chunks[0],
+		},
+		{
+			name:     "Chunks with same hash but different stopChecksum differ",
+			chunk:    chunk{stopChecksum: 1, hash: []byte("bbbb")},
+			expected: &chunks[3],
+		},
+		{
+			name:     "Unknown hash",
+			chunk:    chunk{stopChecksum: 2, hash: []byte("aaaa")},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Same(t, tt.expected, index.find(&tt.chunk), "Found chunk should be as expected")
+		})
+	}
+}
+
+// benchmarkCreateDelta creates delta of size bytes of random data which has been modified every 64 KiB
+func benchmarkCreateDelta(b *testing.B, size int) {
+	var basis = make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(basis)
+
+	var modified = append([]byte(nil), basis...)
+	for i := 0; i < len(modified); i += 64 * 1024 {
+		modified[i] ^= 0xff
+	}
+
+	sig := &bytes.Buffer{}
+	err := createSignature(bytes.NewReader(basis), sig, defaultChunkParams, defaultHashParams, 1, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(modified)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		err = createDelta(bytes.NewReader(sig.Bytes()), bytes.NewReader(modified), NewRdiffDelta(io.Discard), DeltaOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCreateDelta1M(b *testing.B) {
+	benchmarkCreateDelta(b, 1<<20)
+}
+
+func BenchmarkCreateDelta8M(b *testing.B) {
+	benchmarkCreateDelta(b, 8<<20)
+}
+
+func BenchmarkCreateDelta64M(b *testing.B) {
+	benchmarkCreateDelta(b, 64<<20)
+}
+
 const (
 	COMMAND_COPY    = "copy"
 	COMMAND_LITERAL = "literal"
@@ -347,7 +423,7 @@ type mockDeltaBuffer struct {
 	start, length uint64
 }
 
-func (dw *mockDeltaBuffer) Bytes() []byte {
+func (dw *mockDeltaBuffer) Close() error {
 	if dw.openCopy {
 		dw.endCopy()
 	}
@@ -362,7 +438,7 @@ func (dw *mockDeltaBuffer) AddLiteral(data []byte) {
 
 	dw.commands = append(dw.commands, deltaCommand{
 		command: COMMAND_LITERAL,
-		data:    data,
+		data:    append([]byte(nil), data...),
 	})
 }
 
@@ -0,0 +1,193 @@
+package datadiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+const (
+	// diffHashSize is the number of bytes hashed to find match candidates from basis
+	diffHashSize = 4
+
+	// diffMinMatch is the default minimum length of copied data. Shorter matches are written as literals, as COPY
+	// command would not be smaller.
+	diffMinMatch = 16
+
+	// diffMaxChain limits how many earlier basis positions with the same hash are compared
+	diffMaxChain = 256
+
+	// diffNiceMatch stops the search of candidates when a match is at least this long
+	diffNiceMatch = 4096
+
+	// diffMaxBasis is the largest basis file size, as basis positions are stored in 32 bits
+	diffMaxBasis = math.MaxUint32 - 1
+)
+
+// createDiff reads whole basis and newFile and writes delta commands of newFile against basis to deltaB which is
+// closed at the end. Longest matches are searched from hash chains of every basis position like LZ77 compressors do,
+// so moved and repeated data of any length and alignment is copied.
+func createDiff(basis, newFile io.Reader, deltaB DeltaBuffer, opts DiffOptions) error {
+	var log = newLogger(opts.Log)
+
+	basisData, err := io.ReadAll(basis)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %s", argOldFile, err.Error())
+	}
+	if int64(len(basisData)) > diffMaxBasis {
+		return fmt.Errorf("%s file is too large to diff: %d bytes, use signature and delta instead", argOldFile,
+			len(basisData))
+	}
+
+	newData, err := io.ReadAll(newFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %s", argNewFile, err.Error())
+	}
+
+	var minMatch = opts.MinMatch
+	if minMatch == 0 {
+		minMatch = diffMinMatch
+	}
+
+	log.println()
+	log.println("Finding differences:")
+	log.println()
+
+	newDiffIndex(basisData).match(newData, minMatch, deltaB, log)
+
+	var sums = fileChecksums{basis: fileChecksum(basisData), newFile: fileChecksum(newData)}
+	err = closeDelta(deltaB, opts.Format, sums)
+	if err != nil {
+		return fmt.Errorf("failed to write %s file: %s", argDelta, err.Error())
+	}
+
+	return nil
+}
+
+// fileChecksum returns checksum of whole file data
+func fileChecksum(data []byte) []byte {
+	h := newFileHash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// diffIndex finds longest matches from basis. Positions are stored increased by one, so that zero ends the chain.
+type diffIndex struct {
+	basis []byte
+	shift int
+
+	// head contains the last basis position of each hash and prev the previous position with the same hash
+	head []uint32
+	prev []uint32
+}
+
+// newDiffIndex indexes every position of basis
+func newDiffIndex(basis []byte) *diffIndex {
+	// Hash table has about one slot for each basis position
+	var hashBits = bits.Len(uint(len(basis)))
+	if hashBits < 10 {
+		hashBits = 10
+	}
+	if hashBits > 24 {
+		hashBits = 24
+	}
+
+	var d = &diffIndex{
+		basis: basis,
+		shift: 32 - hashBits,
+		head:  make([]uint32, 1<<hashBits),
+		prev:  make([]uint32, len(basis)),
+	}
+
+	for i := 0; i+diffHashSize <= len(basis); i++ {
+		h := d.hash(basis[i:])
+		d.prev[i] = d.head[h]
+		d.head[h] = uint32(i + 1)
+	}
+
+	return d
+}
+
+// hash returns hash table slot of the first diffHashSize bytes of data
+func (d *diffIndex) hash(data []byte) uint32 {
+	return binary.LittleEndian.Uint32(data) * 2654435761 >> d.shift
+}
+
+// longestMatch returns basis position and length of the longest match of data start, or zero length if there is
+// none
+func (d *diffIndex) longestMatch(data []byte) (start, length int) {
+	if len(data) < diffHashSize {
+		return 0, 0
+	}
+
+	var chain int
+	for p := d.head[d.hash(data)]; p != 0 && chain < diffMaxChain; p = d.prev[p-1] {
+		l := commonPrefix(d.basis[p-1:], data)
+		if l > length {
+			start, length = int(p-1), l
+			if l >= diffNiceMatch {
+				break
+			}
+		}
+		chain++
+	}
+
+	return
+}
+
+// commonPrefix returns the length of common prefix of a and b
+func commonPrefix(a, b []byte) int {
+	var n = len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	var i int
+	for ; i+8 <= n; i += 8 {
+		if x := binary.LittleEndian.Uint64(a[i:]) ^ binary.LittleEndian.Uint64(b[i:]); x != 0 {
+			return i + bits.TrailingZeros64(x)/8
+		}
+	}
+	for ; i < n && a[i] == b[i]; i++ {
+	}
+
+	return i
+}
+
+// match writes delta commands of newData to deltaB. Matches shorter than minMatch are written as literals.
+func (d *diffIndex) match(newData []byte, minMatch int, deltaB DeltaBuffer, log *logger) {
+	var lit int // Start of literal data not written yet
+	var matches int
+
+	for p := 0; p < len(newData); {
+		start, length := d.longestMatch(newData[p:])
+		if length < minMatch {
+			p++
+			continue
+		}
+
+		// Data before the match may also match, if the hash of its position did not lead to the same basis position
+		for start > 0 && p > lit && d.basis[start-1] == newData[p-1] {
+			start--
+			p--
+			length++
+		}
+
+		if lit < p {
+			deltaB.AddLiteral(newData[lit:p])
+		}
+		deltaB.AddCopy(uint64(start), uint64(length))
+
+		log.println(matches, "matches basefile at:", start, "Length:", length, "Literal before:", p-lit)
+
+		matches++
+		p += length
+		lit = p
+	}
+
+	if lit < len(newData) {
+		deltaB.AddLiteral(newData[lit:])
+	}
+}
@@ -0,0 +1,206 @@
+package datadiff
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	var basis = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(8)).Read(basis)
+
+	// Small scattered changes that content defined chunks can not isolate
+	var scattered = append([]byte(nil), basis...)
+	for i := 100; i < len(scattered); i += 1000 {
+		scattered[i]++
+	}
+
+	var moved = append(append([]byte(nil), basis[2*chunkReadSize:]...), basis[:2*chunkReadSize]...)
+
+	var tests = []struct {
+		name        string
+		basis       []byte
+		newFile     []byte
+		expectedMax int
+	}{
+		{
+			name:        "Equal files",
+			basis:       basis,
+			newFile:     basis,
+			expectedMax: 100,
+		},
+		{
+			name:        "Scattered changes",
+			basis:       basis,
+			newFile:     scattered,
+			expectedMax: 4000,
+		},
+		{
+			name:        "Moved data",
+			basis:       basis,
+			newFile:     moved,
+			expectedMax: 100,
+		},
+		{
+			name:        "Repeated data",
+			basis:       []byte(strings.Repeat("abc", 1000)),
+			newFile:     []byte(strings.Repeat("abc", 3000) + "d"),
+			expectedMax: 200,
+		},
+		{
+			name:        "Empty basis",
+			newFile:     []byte("new file"),
+			expectedMax: 100,
+		},
+		{
+			name:        "Empty new file",
+			basis:       basis,
+			expectedMax: 100,
+		},
+		{
+			name:        "Short files",
+			basis:       []byte("abc"),
+			newFile:     []byte("ab"),
+			expectedMax: 100,
+		},
+	}
+
+	// Delta of data-diff format ends with 70 bytes of checksums
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := &bytes.Buffer{}
+			err := Diff(bytes.NewReader(tt.basis), bytes.NewReader(tt.newFile), delta, DiffOptions{})
+			assert.NoError(t, err, "Diff should not return error")
+			assert.LessOrEqual(t, delta.Len(), tt.expectedMax, "Delta should mostly consist of copy commands")
+
+			got := &bytes.Buffer{}
+			err = Patch(bytes.NewReader(tt.basis), delta, got, PatchOptions{})
+			assert.NoError(t, err, "Patch should verify checksums of both files")
+			assert.True(t, bytes.Equal(tt.newFile, got.Bytes()), "Patched data should equal to new file")
+		})
+	}
+}
+
+func TestDiffSmallerThanDelta(t *testing.T) {
+	var basis = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(9)).Read(basis)
+
+	var modified = append([]byte(nil), basis...)
+	for i := 500; i < len(modified); i += 3000 {
+		copy(modified[i:], "changed")
+	}
+
+	sig := &bytes.Buffer{}
+	err := Signature(bytes.NewReader(basis), sig, SignatureOptions{})
+	assert.NoError(t, err, "Signature should not return error")
+
+	delta := &bytes.Buffer{}
+	err = Delta(sig, bytes.NewReader(modified), delta, DeltaOptions{ByteMatch: true})
+	assert.NoError(t, err, "Delta should not return error")
+
+	diff := &bytes.Buffer{}
+	err = Diff(bytes.NewReader(basis), bytes.NewReader(modified), diff, DiffOptions{})
+	assert.NoError(t, err, "Diff should not return error")
+
+	assert.Less(t, diff.Len(), delta.Len()/4, "Diff should copy data around changes that delta can not")
+}
+
+func TestDiffFormat(t *testing.T) {
+	var basis = []byte(strings.Repeat("Some basis data. ", 100))
+
+	delta := &bytes.Buffer{}
+	err := Diff(bytes.NewReader(basis), bytes.NewReader(basis), delta, DiffOptions{Format: FormatRdiff})
+	assert.NoError(t, err, "Diff should not return error")
+	assert.Equal(t, joinChunks(RS_DELTA_MAGIC, "\x46\x00\x06\xa4", "\x00"), delta.Bytes(),
+		"Rdiff delta should have single copy and no checksums")
+
+	var tests = []struct {
+		name        string
+		opts        DiffOptions
+		expectedErr string
+	}{
+		{
+			name:        "Unknown format",
+			opts:        DiffOptions{Format: "zip"},
+			expectedErr: "unsupported delta format: zip",
+		},
+		{
+			name:        "Too short minimum match",
+			opts:        DiffOptions{MinMatch: 2},
+			expectedErr: "minimum match has to be at least 4 bytes: 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Diff(bytes.NewReader(basis), bytes.NewReader(basis), &bytes.Buffer{}, tt.opts)
+			assert.EqualError(t, err, tt.expectedErr)
+		})
+	}
+}
+
+func TestDiffMinMatch(t *testing.T) {
+	var basis = []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	var newFile = []byte("xx0123456789xxabcdefghijklmnopqrstuvwxyz")
+
+	var tests = []struct {
+		minMatch int
+		expected []deltaCommand
+	}{
+		{
+			minMatch: 4,
+			expected: []deltaCommand{
+				{command: COMMAND_LITERAL, data: []byte("xx")},
+				{command: COMMAND_COPY, start: 0, length: 10},
+				{command: COMMAND_LITERAL, data: []byte("xx")},
+				{command: COMMAND_COPY, start: 10, length: 26},
+			},
+		},
+		{
+			minMatch: 16,
+			expected: []deltaCommand{
+				{command: COMMAND_LITERAL, data: []byte("xx0123456789xx")},
+				{command: COMMAND_COPY, start: 10, length: 26},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		deltaB := &mockDeltaBuffer{}
+		err := createDiff(bytes.NewReader(basis), bytes.NewReader(newFile), deltaB, DiffOptions{MinMatch: tt.minMatch})
+		assert.NoError(t, err, "createDiff should not return error")
+		assert.Equal(t, tt.expected, deltaB.commands, "Matches should be at least %d bytes", tt.minMatch)
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	var data = []byte("0123456789abcdefghij")
+
+	for i := 0; i <= len(data); i++ {
+		other := append(append([]byte(nil), data[:i]...), '-')
+
+		assert.Equal(t, i, commonPrefix(data, other), "Common prefix should be %d bytes", i)
+		assert.Equal(t, i, commonPrefix(other, data), "Common prefix should be %d bytes", i)
+	}
+}
+
+func BenchmarkDiff(b *testing.B) {
+	var basis = make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(basis)
+
+	var modified = append([]byte(nil), basis...)
+	for i := 0; i < len(modified); i += 4096 {
+		modified[i]++
+	}
+
+	b.SetBytes(int64(len(modified)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		Diff(bytes.NewReader(basis), bytes.NewReader(modified), &bytes.Buffer{}, DiffOptions{})
+	}
+}
@@ -0,0 +1,177 @@
+package datadiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+)
+
+// applyPatch reconstructs new file to out by applying rdiff, VCDIFF or BSDIFF40 delta to basis file. If the delta has
+// checksum trailer, basis and the reconstructed file are verified against it.
+func applyPatch(basis io.ReaderAt, delta io.Reader, out io.Writer, log *logger) error {
+	r := bufio.NewReader(delta)
+
+	head, _ := r.Peek(len(BSDIFF_MAGIC))
+	switch {
+	case bytes.HasPrefix(head, []byte(VCDIFF_MAGIC)):
+		return applyVcdiffPatch(basis, r, out, log)
+	case string(head) == BSDIFF_MAGIC:
+		return applyBsdiffPatch(basis, r, out, log)
+	}
+
+	// Output is hashed as it is written, as checksums are known only at the end of delta
+	h := newFileHash()
+	out = io.MultiWriter(out, h)
+
+	err := readDeltaMagic(r)
+	if err != nil {
+		return err
+	}
+
+	for {
+		cmd, err := readCommand(r)
+		if err != nil {
+			return err
+		}
+
+		switch cmd.op {
+		case RS_OP_END:
+			log.println("END")
+			return verifyPatch(r, basis, h)
+		case RS_OP_LITERAL_1:
+			log.println("LITERAL", cmd.length)
+			err = patchLiteral(out, r, cmd.length)
+		case RS_OP_COPY_N1_N1:
+			log.println("COPY", cmd.start, cmd.length)
+			err = patchCopy(out, basis, cmd.start, cmd.length)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readDeltaMagic reads magic of rdiff delta from r
+func readDeltaMagic(r io.Reader) error {
+	magic := make([]byte, len(RS_DELTA_MAGIC))
+	_, err := io.ReadFull(r, magic)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file magic: %s", argDelta, err.Error())
+	}
+	if string(magic) != RS_DELTA_MAGIC {
+		return fmt.Errorf("%s file is not an rdiff delta", argDelta)
+	}
+
+	return nil
+}
+
+// rdiffCommand is decoded rdiff delta command. Literal data follows the command in delta.
+type rdiffCommand struct {
+	// op is RS_OP_END, RS_OP_LITERAL_1 for all literals or RS_OP_COPY_N1_N1 for all copies
+	op uint8
+
+	start  uint64
+	length uint64
+}
+
+// readCommand reads the next command from delta
+func readCommand(r *bufio.Reader) (cmd rdiffCommand, err error) {
+	op, err := r.ReadByte()
+	if err != nil {
+		return cmd, fmt.Errorf("failed to read %s command: %s", argDelta, err.Error())
+	}
+
+	switch {
+	case op == RS_OP_END:
+		cmd.op = RS_OP_END
+	case op >= RS_OP_LITERAL_1 && op <= RS_OP_LITERAL_64:
+		cmd.op = RS_OP_LITERAL_1
+		cmd.length = uint64(op)
+	case op >= RS_OP_LITERAL_N1 && op <= RS_OP_LITERAL_N8:
+		cmd.op = RS_OP_LITERAL_1
+		cmd.length, err = readDeltaInt(r, 1<<(op-RS_OP_LITERAL_N1))
+		if err != nil {
+			return cmd, fmt.Errorf("failed to read LITERAL length: %s", err.Error())
+		}
+		if cmd.length > math.MaxInt64 {
+			return cmd, fmt.Errorf("invalid %s file: LITERAL length %d is too large", argDelta, cmd.length)
+		}
+	case op >= RS_OP_COPY_N1_N1 && op <= RS_OP_COPY_N8_N8:
+		cmd.op = RS_OP_COPY_N1_N1
+		cmd.start, err = readDeltaInt(r, 1<<((op-RS_OP_COPY_N1_N1)/4))
+		if err != nil {
+			return cmd, fmt.Errorf("failed to read COPY start: %s", err.Error())
+		}
+		cmd.length, err = readDeltaInt(r, 1<<((op-RS_OP_COPY_N1_N1)%4))
+		if err != nil {
+			return cmd, fmt.Errorf("failed to read COPY length: %s", err.Error())
+		}
+	default:
+		return cmd, fmt.Errorf("unknown %s command: 0x%02x", argDelta, op)
+	}
+
+	return cmd, nil
+}
+
+// readDeltaInt reads big endian unsigned integer which is size bytes long
+func readDeltaInt(r io.Reader, size int) (uint64, error) {
+	var b [8]byte
+	_, err := io.ReadFull(r, b[8-size:])
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+// patchLiteral copies length bytes of literal data from delta to out
+func patchLiteral(out io.Writer, delta io.Reader, length uint64) error {
+	n, err := io.CopyN(out, delta, int64(length))
+	if err != nil {
+		return fmt.Errorf("failed to read LITERAL data (%d of %d bytes): %s", n, length, err.Error())
+	}
+
+	return nil
+}
+
+// patchCopy copies length bytes starting from start of basis file to out
+func patchCopy(out io.Writer, basis io.ReaderAt, start, length uint64) error {
+	n, err := io.Copy(out, io.NewSectionReader(basis, int64(start), int64(length)))
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %s", argOldFile, err.Error())
+	}
+	if uint64(n) != length {
+		return fmt.Errorf("COPY command [%d, %d] exceeds %s file", start, length, argOldFile)
+	}
+
+	return nil
+}
+
+// verifyPatch reads checksum trailer that follows END command from delta and verifies basis and the patched file
+// which was hashed to h against it
+func verifyPatch(delta io.Reader, basis io.ReaderAt, h hash.Hash) error {
+	sums, err := readChecksums(delta)
+	if err != nil {
+		return fmt.Errorf("invalid %s file: %s", argDelta, err.Error())
+	}
+
+	if sums.basis != nil {
+		bh := newFileHash()
+		_, err = io.Copy(bh, io.NewSectionReader(basis, 0, math.MaxInt64))
+		if err != nil {
+			return fmt.Errorf("failed to read %s file: %s", argOldFile, err.Error())
+		}
+
+		err = verifyChecksum(argOldFile, sums.basis, bh)
+		if err != nil {
+			return err
+		}
+	}
+
+	return verifyChecksum(argNewFile, sums.newFile, h)
+}
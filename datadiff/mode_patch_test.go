@@ -0,0 +1,307 @@
+package datadiff
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyPatch(t *testing.T) {
+	var basis = []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+	var tests = []struct {
+		name        string
+		delta       []byte
+		expected    []byte
+		expectedErr string
+	}{
+		{
+			name:     "Empty delta",
+			delta:    joinChunks(RS_DELTA_MAGIC, "\x00"),
+			expected: []byte{},
+		},
+		{
+			name:     "Literal with length in command",
+			delta:    joinChunks(RS_DELTA_MAGIC, "\x05hello\x00"),
+			expected: []byte("hello"),
+		},
+		{
+			name: "Literal with all length sizes",
+			delta: joinChunks(
+				RS_DELTA_MAGIC,
+				"\x41\x01a",
+				"\x42\x00\x01b",
+				"\x43\x00\x00\x00\x01c",
+				"\x44\x00\x00\x00\x00\x00\x00\x00\x01d",
+				"\x00",
+			),
+			expected: []byte("abcd"),
+		},
+		{
+			name: "Copy with different start and length sizes",
+			delta: joinChunks(
+				RS_DELTA_MAGIC,
+				"\x45\x0a\x03",
+				"\x4a\x00\x01\x00\x02",
+				"\x50\x00\x00\x00\x10\x00\x00\x00\x00\x00\x00\x00\x04",
+				"\x54\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01",
+				"\x00",
+			),
+			expected: []byte("abc12ghij0"),
+		},
+		{
+			name:        "Wrong magic",
+			delta:       []byte("rs\x016\x00"),
+			expectedErr: "DELTA file is not an rdiff delta",
+		},
+		{
+			name:        "Missing end command",
+			delta:       joinChunks(RS_DELTA_MAGIC, "\x01a"),
+			expectedErr: "failed to read DELTA command: EOF",
+		},
+		{
+			name:        "Truncated literal",
+			delta:       joinChunks(RS_DELTA_MAGIC, "\x05abc"),
+			expectedErr: "failed to read LITERAL data (3 of 5 bytes): EOF",
+		},
+		{
+			name:        "Literal length overflows",
+			delta:       joinChunks(RS_DELTA_MAGIC, "\x44\x80\x00\x00\x00\x00\x00\x00\x00abc"),
+			expectedErr: "invalid DELTA file: LITERAL length 9223372036854775808 is too large",
+		},
+		{
+			name:        "Copy outside of basis",
+			delta:       joinChunks(RS_DELTA_MAGIC, "\x45\x20\x10\x00"),
+			expectedErr: "COPY command [32, 16] exceeds BASIS file",
+		},
+		{
+			name:        "Unknown command",
+			delta:       joinChunks(RS_DELTA_MAGIC, "\x55\x00"),
+			expectedErr: "unknown DELTA command: 0x55",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &bytes.Buffer{}
+			err := applyPatch(bytes.NewReader(basis), bytes.NewReader(tt.delta), got, nil)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "applyPatch should not return error")
+			assert.Equal(t, string(tt.expected), got.String(), "Patched data should be as expected")
+		})
+	}
+}
+
+func TestApplyPatchRoundTrip(t *testing.T) {
+	var basisChunks []string
+	_, chunks, err := readSignature(bytes.NewReader(signature), int64(len(signature)))
+	if err != nil {
+		panic(err)
+	}
+
+	for _, chunk := range chunks {
+		basisChunks = append(basisChunks, string(basisFile[chunk.start:chunk.start+chunk.size]))
+	}
+
+	var tests = []struct {
+		name     string
+		modified []byte
+	}{
+		{
+			name:     "Unmodified",
+			modified: basisFile,
+		},
+		{
+			name: "Modified chunk",
+			modified: joinChunks(
+				basisChunks[0],
+				basisChunks[1],
+				strings.Replace(basisChunks[2], "CASCADE", "RESTRICT", 1),
+				basisChunks[3],
+				basisChunks[4],
+				basisChunks[5],
+				basisChunks[6],
+			),
+		},
+		{
+			name: "Chunks changed places and content added",
+			modified: joinChunks(
+				"Added content",
+				basisChunks[5],
+				basisChunks[0],
+				basisChunks[6],
+				"Added content",
+				basisChunks[2],
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := &bytes.Buffer{}
+			err := createDelta(bytes.NewReader(signature), bytes.NewReader(tt.modified), NewRdiffDelta(delta), DeltaOptions{})
+			assert.NoError(t, err, "createDelta should not return error")
+
+			got := &bytes.Buffer{}
+			err = applyPatch(bytes.NewReader(basisFile), delta, got, nil)
+			assert.NoError(t, err, "applyPatch should not return error")
+			assert.Equal(t, string(tt.modified), got.String(), "Patched data should equal to modified data")
+		})
+	}
+}
+
+func TestSignatureDeltaPatchRoundTrip(t *testing.T) {
+	var basis = make([]byte, 5*chunkReadSize)
+	rand.New(rand.NewSource(2)).Read(basis)
+
+	var modified = append([]byte(nil), basis[:chunkReadSize]...)
+	modified = append(modified, "Added content"...)
+	modified = append(modified, basis[chunkReadSize+100:3*chunkReadSize]...)
+	modified = append(modified, basis[4*chunkReadSize:]...)
+	modified = append(modified, basis[3*chunkReadSize:4*chunkReadSize]...)
+
+	var tests = []struct {
+		name       string
+		params     chunkParams
+		hashParams hashParams
+	}{
+		{
+			name:       "Default chunk parameters",
+			params:     defaultChunkParams,
+			hashParams: defaultHashParams,
+		},
+		{
+			name: "Custom chunk parameters",
+			params: chunkParams{
+				minSize:   256,
+				maxSize:   8192,
+				separator: 0x3ff,
+			},
+			hashParams: defaultHashParams,
+		},
+		{
+			name:       "SHA-256 hash",
+			params:     defaultChunkParams,
+			hashParams: hashParams{id: hashSHA256, size: 32},
+		},
+		{
+			name:       "Truncated BLAKE2b hash",
+			params:     defaultChunkParams,
+			hashParams: hashParams{id: hashBLAKE2b, size: 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := &bytes.Buffer{}
+			err := createSignature(bytes.NewReader(basis), sig, tt.params, tt.hashParams, 1, nil)
+			assert.NoError(t, err, "createSignature should not return error")
+
+			// Delta uses chunk parameters and strong hash of signature
+			delta := &bytes.Buffer{}
+			err = createDelta(sig, bytes.NewReader(modified), NewRdiffDelta(delta), DeltaOptions{})
+			assert.NoError(t, err, "createDelta should not return error")
+			assert.Less(t, delta.Len(), len(modified)/10, "Delta should mostly consist of copy commands")
+
+			got := &bytes.Buffer{}
+			err = applyPatch(bytes.NewReader(basis), delta, got, nil)
+			assert.NoError(t, err, "applyPatch should not return error")
+			assert.True(t, bytes.Equal(modified, got.Bytes()), "Patched data should equal to modified data")
+		})
+	}
+}
+
+func TestRdiffSignatureDeltaPatchRoundTrip(t *testing.T) {
+	var basis = make([]byte, 5*chunkReadSize+100)
+	rand.New(rand.NewSource(2)).Read(basis)
+
+	var modified = append([]byte(nil), basis[:chunkReadSize]...)
+	modified = append(modified, "Added content"...)
+	modified = append(modified, basis[chunkReadSize+100:3*chunkReadSize]...)
+	modified = append(modified, basis[4*chunkReadSize:]...)
+	modified = append(modified, basis[3*chunkReadSize:4*chunkReadSize]...)
+
+	var tests = []struct {
+		name      string
+		hash      string
+		blockLen  int
+		strongLen int
+		basis     []byte
+		modified  []byte
+	}{
+		{
+			name:     "MD4 signature",
+			hash:     "md4",
+			blockLen: RS_DEFAULT_BLOCK_LEN,
+			basis:    basis,
+			modified: modified,
+		},
+		{
+			name:      "Truncated BLAKE2 signature with small blocks",
+			hash:      "blake2b",
+			blockLen:  100,
+			strongLen: 8,
+			basis:     basis,
+			modified:  modified,
+		},
+		{
+			name:     "Block larger than read buffer",
+			hash:     "blake2b",
+			blockLen: 2 * chunkReadSize,
+			basis:    basis,
+			modified: modified,
+		},
+		{
+			name:     "New file shorter than block",
+			hash:     "blake2b",
+			blockLen: RS_DEFAULT_BLOCK_LEN,
+			basis:    basis,
+			modified: basis[5*chunkReadSize:],
+		},
+		{
+			name:     "Empty basis",
+			hash:     "md4",
+			blockLen: RS_DEFAULT_BLOCK_LEN,
+			basis:    nil,
+			modified: modified,
+		},
+		{
+			name:     "Empty new file",
+			hash:     "md4",
+			blockLen: RS_DEFAULT_BLOCK_LEN,
+			basis:    basis,
+			modified: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newRdiffParams(tt.hash, tt.blockLen, tt.strongLen)
+			assert.NoError(t, err, "newRdiffParams should not return error")
+
+			sig := &bytes.Buffer{}
+			err = createRdiffSignature(bytes.NewReader(tt.basis), sig, p)
+			assert.NoError(t, err, "createRdiffSignature should not return error")
+
+			delta := &bytes.Buffer{}
+			err = createDelta(sig, bytes.NewReader(tt.modified), NewRdiffDelta(delta), DeltaOptions{})
+			assert.NoError(t, err, "createDelta should not return error")
+			if len(tt.basis) > 0 {
+				assert.LessOrEqual(t, delta.Len(), len(tt.modified)/10+tt.blockLen*4+32, "Delta should mostly consist of copy commands")
+			}
+
+			got := &bytes.Buffer{}
+			err = applyPatch(bytes.NewReader(tt.basis), delta, got, nil)
+			assert.NoError(t, err, "applyPatch should not return error")
+			assert.True(t, bytes.Equal(tt.modified, got.Bytes()), "Patched data should equal to modified data")
+		})
+	}
+}
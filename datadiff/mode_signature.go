@@ -0,0 +1,81 @@
+package datadiff
+
+import (
+	"fmt"
+	"io"
+)
+
+// createSignature creates signature file witch contains chunks of oldFile (a.k.a Basis file) resolved with p and
+// hashed with hp in jobs goroutines, followed by checksum of whole oldFile
+func createSignature(oldFile io.Reader, out io.Writer, p chunkParams, hp hashParams, jobs int, log *logger) error {
+	c, err := newChunker(p, hp, jobs, log)
+	if err != nil {
+		return err
+	}
+
+	sw, err := newSignatureWriter(out, newSignatureHeader(p, hp))
+	if err != nil {
+		return fmt.Errorf("failed to write %s file: %s", argSignature, err.Error())
+	}
+
+	// Whole basis file is hashed while it is read
+	var h = newFileHash()
+	oldFile = io.TeeReader(oldFile, h)
+
+	var writeErr error
+	err = c.resolve(oldFile, func(c chunk, _ []byte) error {
+		writeErr = sw.writeChunk(c)
+		return writeErr
+	})
+	if writeErr != nil {
+		return fmt.Errorf("failed to write %s file: %s", argSignature, writeErr.Error())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s file: %s", argOldFile, err.Error())
+	}
+
+	err = sw.close(h.Sum(nil))
+	if err != nil {
+		return fmt.Errorf("failed to write %s file: %s", argSignature, err.Error())
+	}
+
+	return nil
+}
+
+// createRdiffSignature creates librsync signature of oldFile (a.k.a Basis file) which is split into blocks of p
+func createRdiffSignature(oldFile io.Reader, out io.Writer, p rdiffParams) error {
+	err := writeRdiffSignatureHeader(out, p)
+	if err != nil {
+		return fmt.Errorf("failed to write %s file: %s", argSignature, err.Error())
+	}
+
+	var h = p.newStrongHash()
+	var buf = make([]byte, p.blockLen)
+	var strong = make([]byte, 0, h.Size())
+
+	for {
+		n, err := io.ReadFull(oldFile, buf)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read %s file: %s", argOldFile, err.Error())
+		}
+
+		h.Reset()
+		h.Write(buf[:n])
+
+		err = writeRdiffBlock(out, rdiffBlock{
+			weak:   calcRollsum(buf[:n]),
+			strong: h.Sum(strong[:0])[:p.strongLen],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write %s file: %s", argSignature, err.Error())
+		}
+
+		if n < len(buf) {
+			// Last block is shorter
+			return nil
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package datadiff
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+const (
+	// rabinWindowSize is the window of Rabin fingerprint like in restic
+	rabinWindowSize = 64
+
+	// defaultRabinPolynomial is irreducible polynomial of degree 53 over GF(2)
+	defaultRabinPolynomial = uint64(0x3DA3358B4DC173)
+
+	// Degree limits of Rabin polynomial. Fingerprint shifted by a byte has to fit in 64 bits and it has to have more
+	// bits than the separator of any average chunk size.
+	rabinMinDegree = 32
+	rabinMaxDegree = 56
+)
+
+// polyDegree returns degree of polynomial p over GF(2), -1 for zero polynomial
+func polyDegree(p uint64) int {
+	return bits.Len64(p) - 1
+}
+
+// polyMod returns remainder of polynomial a divided by p over GF(2)
+func polyMod(a, p uint64) uint64 {
+	var d = polyDegree(p)
+	for i := polyDegree(a); i >= d; i = polyDegree(a) {
+		a ^= p << (i - d)
+	}
+
+	return a
+}
+
+// polyMulMod returns a*b mod p over GF(2). A and b have to be smaller than p.
+func polyMulMod(a, b, p uint64) uint64 {
+	var d = polyDegree(p)
+	var r uint64
+
+	for i := polyDegree(b); i >= 0; i-- {
+		r <<= 1
+		if r>>d&1 == 1 {
+			r ^= p
+		}
+		if b>>i&1 == 1 {
+			r ^= a
+		}
+	}
+
+	return r
+}
+
+// polyGCD returns greatest common divisor of polynomials a and b over GF(2)
+func polyGCD(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, polyMod(a, b)
+	}
+
+	return a
+}
+
+// polyIrreducible tells whether polynomial p over GF(2) is irreducible. It uses Ben-Or's test: p of degree d is
+// irreducible if gcd(p, x^(2^i) - x) = 1 for each i up to d/2.
+func polyIrreducible(p uint64) bool {
+	var d = polyDegree(p)
+	if d < 1 {
+		return false
+	}
+
+	var x = polyMod(2, p)
+	var h = x
+	for i := 1; i <= d/2; i++ {
+		h = polyMulMod(h, h, p)
+		if polyGCD(p, h^x) != 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkRabinPolynomial returns error if p can not be used as polynomial of Rabin fingerprint
+func checkRabinPolynomial(p uint64) error {
+	if d := polyDegree(p); d < rabinMinDegree || d > rabinMaxDegree {
+		return fmt.Errorf("rabin polynomial 0x%x has degree %d, it has to be between %d and %d", p, d,
+			rabinMinDegree, rabinMaxDegree)
+	}
+
+	if !polyIrreducible(p) {
+		return fmt.Errorf("rabin polynomial 0x%x is not irreducible", p)
+	}
+
+	return nil
+}
+
+// rabinHash calculates Rabin fingerprints modulo polynomial with precalculated tables
+type rabinHash struct {
+	// shift is the amount which moves the highest byte of fingerprint to the lowest bits
+	shift int
+
+	// mod contains for each high byte of shifted fingerprint the value that clears the byte and adds its remainder
+	mod [256]uint64
+
+	// out contains for each byte its fingerprint when it is the first byte in the window
+	out [256]uint64
+}
+
+// newRabinHash creates rabinHash of polynomial p
+func newRabinHash(p uint64) (*rabinHash, error) {
+	err := checkRabinPolynomial(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var d = polyDegree(p)
+	var rh = &rabinHash{shift: d - 8}
+
+	for b := uint64(0); b < 256; b++ {
+		rh.mod[b] = polyMod(b<<d, p) | b<<d
+	}
+
+	for b := range rh.out {
+		var h = rh.append(0, byte(b))
+		for i := 0; i < rabinWindowSize-1; i++ {
+			h = rh.append(h, 0)
+		}
+		rh.out[b] = h
+	}
+
+	return rh, nil
+}
+
+// append returns fingerprint of data after byte b is appended to data with fingerprint h
+func (rh *rabinHash) append(h uint64, b byte) uint64 {
+	var i = h >> rh.shift
+
+	return (h<<8 | uint64(b)) ^ rh.mod[i]
+}
+
+// calc calculates Rabin fingerprint of each window of data and appends them to hashes like calcRollingHash does
+func (rh *rabinHash) calc(data []byte, hashes []uint64) []uint64 {
+	if len(data) < rabinWindowSize {
+		return hashes
+	}
+
+	var h uint64
+	for _, b := range data[:rabinWindowSize] {
+		h = rh.append(h, b)
+	}
+	hashes = append(hashes, h)
+
+	for i := rabinWindowSize; i < len(data); i++ {
+		h = rh.append(h^rh.out[data[i-rabinWindowSize]], data[i])
+		hashes = append(hashes, h)
+	}
+
+	return hashes
+}
@@ -0,0 +1,223 @@
+package datadiff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolyIrreducible(t *testing.T) {
+	// Number of irreducible polynomials of each degree over GF(2), OEIS A001037
+	var expected = []int{0, 2, 1, 2, 3, 6, 9, 18, 30, 56, 99, 186, 335}
+
+	for d := 1; d < len(expected); d++ {
+		var count int
+		for p := uint64(1) << d; p < 1<<(d+1); p++ {
+			if polyIrreducible(p) {
+				count++
+			}
+		}
+
+		assert.Equal(t, expected[d], count, "There should be %d irreducible polynomials of degree %d", expected[d], d)
+	}
+
+	assert.True(t, polyIrreducible(0x11b), "AES polynomial should be irreducible")
+	assert.True(t, polyIrreducible(0x100400007), "Primitive polynomial should be irreducible")
+	assert.True(t, polyIrreducible(defaultRabinPolynomial), "Default polynomial should be irreducible")
+
+	// Product is not reduced by x^56 as its degree is 40
+	assert.False(t, polyIrreducible(polyMulMod(0x11b, 0x100400007, 1<<56)), "Product should not be irreducible")
+}
+
+func TestCheckRabinPolynomial(t *testing.T) {
+	var tests = []struct {
+		name        string
+		polynomial  uint64
+		expectedErr string
+	}{
+		{
+			name:       "Default polynomial",
+			polynomial: defaultRabinPolynomial,
+		},
+		{
+			name:       "Polynomial of minimum degree",
+			polynomial: 0x100400007,
+		},
+		{
+			name:        "Too small degree",
+			polynomial:  0x11b,
+			expectedErr: "rabin polynomial 0x11b has degree 8, it has to be between 32 and 56",
+		},
+		{
+			name:        "Too large degree",
+			polynomial:  1<<60 | 1,
+			expectedErr: "rabin polynomial 0x1000000000000001 has degree 60, it has to be between 32 and 56",
+		},
+		{
+			name:        "Reducible polynomial",
+			polynomial:  1<<53 | 1,
+			expectedErr: "rabin polynomial 0x20000000000001 is not irreducible",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRabinPolynomial(tt.polynomial)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "checkRabinPolynomial should not return error")
+		})
+	}
+}
+
+func TestRabinHash(t *testing.T) {
+	var data = make([]byte, 100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	rh, err := newRabinHash(defaultRabinPolynomial)
+	assert.NoError(t, err, "newRabinHash should not return error")
+
+	hashes := rh.calc(data, nil)
+
+	assert.Len(t, hashes, len(data)-rabinWindowSize+1, "There should be hash for each window")
+	assert.Equal(t, uint64(0x44b76cac5cee3), hashes[0], "Hash of first window should not change")
+	assert.Equal(t, uint64(0x3979e81437bd7), hashes[len(hashes)-1], "Hash of last window should not change")
+}
+
+func TestRabinHashWindow(t *testing.T) {
+	var data = make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, p := range []uint64{defaultRabinPolynomial, 0x100400007} {
+		rh, err := newRabinHash(p)
+		assert.NoError(t, err, "newRabinHash should not return error")
+
+		hashes := rh.calc(data, nil)
+
+		// Fingerprint is the remainder of window bytes as polynomial divided by p
+		var x8 = polyMod(1<<8, p)
+		for i := rabinWindowSize - 1; i < len(data); i++ {
+			var expected uint64
+			for _, b := range data[i-rabinWindowSize+1 : i+1] {
+				expected = polyMulMod(expected, x8, p) ^ uint64(b)
+			}
+
+			assert.Equal(t, expected, hashes[i-rabinWindowSize+1], "Hash of window ending at %d should match", i)
+		}
+	}
+}
+
+func TestRabinHashShortData(t *testing.T) {
+	rh, err := newRabinHash(defaultRabinPolynomial)
+	assert.NoError(t, err, "newRabinHash should not return error")
+
+	for _, size := range []int{0, 1, rabinWindowSize - 1} {
+		hashes := rh.calc(make([]byte, size), []uint64{7})
+
+		assert.Equal(t, []uint64{7}, hashes, "Data of %d bytes should have no windows", size)
+	}
+
+	assert.Len(t, rh.calc(make([]byte, rabinWindowSize), nil), 1, "Data of window size should have one window")
+}
+
+func TestRabinChunksRestic(t *testing.T) {
+	// Chunks of restic/chunker for 32 MiB of little endian math/rand Uint32 values with seed 23, polynomial
+	// 0x3DA3358B4DC173 and default sizes: length, cut fingerprint and SHA-256 of data
+	var expected = []struct {
+		length uint64
+		cut    uint64
+		digest string
+	}{
+		{2163460, 0x000b98d4cdf00000, "4b94cb2cf293855ea43bf766731c74969b91aa6bf3c078719aabdd19860d590d"},
+		{643703, 0x000d4e8364d00000, "5727a63c0964f365ab8ed2ccf604912f2ea7be29759a2b53ede4d6841e397407"},
+		{1528956, 0x0015a25c2ef00000, "a73759636a1e7a2758767791c69e81b69fb49236c6929e5d1b654e06e37674ba"},
+		{1955808, 0x00102a8242e00000, "c955fb059409b25f07e5ae09defbbc2aadf117c97a3724e06ad4abd2787e6824"},
+		{2222372, 0x00045da878000000, "6ba5e9f7e1b310722be3627716cf469be941f7f3e39a4c3bcefea492ec31ee56"},
+		{2538687, 0x00198a8179900000, "8687937412f654b5cfe4a82b08f28393a0c040f77c6f95e26742c2fc4254bfde"},
+		{609606, 0x001d4e8d17100000, "5da820742ff5feb3369112938d3095785487456f65a8efc4b96dac4be7ebb259"},
+		{1205738, 0x000a7204dd600000, "cc70d8fad5472beb031b1aca356bcab86c7368f40faa24fe5f8922c6c268c299"},
+		{959742, 0x00183e71e1400000, "4065bdd778f95676c92b38ac265d361f81bff17d76e5d9452cf985a2ea5a4e39"},
+		{4036109, 0x001fec043c700000, "b9cf166e75200eb4993fc9b6e22300a6790c75e6b0fc8f3f29b68a752d42f275"},
+		{1525894, 0x000b1574b1500000, "2f238180e4ca1f7520a05f3d6059233926341090f9236ce677690c1823eccab3"},
+		{1352720, 0x00018965f2e00000, "afd12f13286a3901430de816e62b85cc62468c059295ce5888b76b3af9028d84"},
+		{811884, 0x00155628aa100000, "42d0cdb1ee7c48e552705d18e061abb70ae7957027db8ae8db37ec756472a70a"},
+		{1282314, 0x001909a0a1400000, "819721c2457426eb4f4c7565050c44c32076a56fa9b4515a1c7796441730eb58"},
+		{1318021, 0x001cceb980000000, "842eb53543db55bacac5e25cb91e43cc2e310fe5f9acc1aee86bdf5e91389374"},
+		{948640, 0x0011f7a470a00000, "b8e36bf7019bb96ac3fb7867659d2167d9d3b3148c09fe0de45850b8fe577185"},
+		{645464, 0x00030ce2d9400000, "5584bd27982191c3329f01ed846bfd266e96548dfa87018f745c33cfc240211d"},
+		{533758, 0x0004435c53c00000, "4da778a25b72a9a0d53529eccfe2e5865a789116cb1800f470d8df685a8ab05d"},
+		{1128303, 0x0000c48517800000, "08c6b0b38095b348d80300f0be4c5184d2744a17147c2cba5cc4315abf4c048f"},
+		{800374, 0x000968473f900000, "820284d2c8fd243429674c996d8eb8d3450cbc32421f43113e980f516282c7bf"},
+		{2453512, 0x001e197c92600000, "5fa870ed107c67704258e5e50abe67509fb73562caf77caa843b5f243425d853"},
+		{2651975, 0x000ae6c868000000, "181347d2bbec32bef77ad5e9001e6af80f6abcf3576549384d334ee00c1988d8"},
+		{237392, 0x0000000000000001, "fcd567f5d866357a8e299fd5b2359bb2c8157c30395229c4e9b0a353944a7978"},
+	}
+
+	var data = make([]byte, 32*1024*1024)
+	var rnd = rand.New(rand.NewSource(23))
+	for i := 0; i < len(data); i += 4 {
+		binary.LittleEndian.PutUint32(data[i:], rnd.Uint32())
+	}
+
+	var opts = SignatureOptions{Chunker: ChunkerRabin, MinChunk: 512 * 1024, MaxChunk: 8 << 20, AvgChunk: 1 << 20}
+	rc, err := opts.chunker()
+	assert.NoError(t, err, "chunker should not return error")
+
+	for _, jobs := range []int{1, 4} {
+		c := testChunker(rc.params)
+		c.jobs = jobs
+
+		var got []chunk
+		err = c.resolve(bytes.NewReader(data), func(c chunk, chunkData []byte) error {
+			digest := sha256.Sum256(chunkData)
+			c.hash = digest[:]
+			got = append(got, c)
+			return nil
+		})
+		assert.NoError(t, err, "resolve should not return error")
+		assert.Len(t, got, len(expected), "There should be as many chunks as restic finds")
+
+		var start uint64
+		for i := 0; i < len(got) && i < len(expected); i++ {
+			assert.Equal(t, start, got[i].start, "Chunk %d should start where previous ended", i)
+			assert.Equal(t, expected[i].length, got[i].size, "Chunk %d should have restic's length", i)
+			assert.Equal(t, expected[i].digest, hex.EncodeToString(got[i].hash), "Chunk %d should have restic's data", i)
+
+			// Restic's last chunk is shorter than minimum so its fingerprint is the digest reset for the chunk
+			if i < len(expected)-1 {
+				assert.Equal(t, expected[i].cut, got[i].stopChecksum, "Chunk %d should end at restic's fingerprint", i)
+			}
+
+			start += got[i].size
+		}
+	}
+}
+
+func BenchmarkRabinHash(b *testing.B) {
+	var data = make([]byte, 1<<20)
+	var hashes = make([]uint64, 0, len(data))
+	rand.New(rand.NewSource(1)).Read(data)
+
+	rh, err := newRabinHash(defaultRabinPolynomial)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		hashes = rh.calc(data, hashes[:0])
+	}
+}
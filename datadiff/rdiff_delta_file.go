@@ -0,0 +1,141 @@
+package datadiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const (
+	RS_DELTA_MAGIC = "rs\x026"
+
+	// End of delta
+	RS_OP_END = uint8(0x00)
+
+	// Literal length is the command itself
+	RS_OP_LITERAL_1  = uint8(0x01)
+	RS_OP_LITERAL_64 = uint8(0x40)
+
+	// Literal length follows as 1, 2, 4 or 8 byte integer
+	RS_OP_LITERAL_N1 = uint8(0x41)
+	RS_OP_LITERAL_N8 = uint8(0x44)
+
+	// Copy start and length follow as 1, 2, 4 or 8 byte integers.
+	// Commands are ordered by start size and then by length size.
+	RS_OP_COPY_N1_N1 = uint8(0x45)
+	RS_OP_COPY_N8_N8 = uint8(0x54)
+)
+
+// RdiffDelta writes rdiff delta file to buffered writer
+type RdiffDelta struct {
+	b *bufio.Writer
+
+	openCopy bool
+	start    uint64
+	length   uint64
+}
+
+// NewRdiffDelta initiates delta file buffer writing to w
+func NewRdiffDelta(w io.Writer) DeltaBuffer {
+	dw := &RdiffDelta{
+		b: bufio.NewWriter(w),
+	}
+	dw.b.WriteString(RS_DELTA_MAGIC)
+
+	return dw
+}
+
+// Close writes end command and flushes the buffer. Write errors of earlier commands are returned here.
+func (dw *RdiffDelta) Close() error {
+	if dw.openCopy {
+		dw.endCopy()
+	}
+
+	// Write end command
+	dw.b.WriteByte(RS_OP_END)
+	return dw.b.Flush()
+}
+
+// closeWithChecksums closes the delta like Close and writes checksum trailer of c after the END command
+func (dw *RdiffDelta) closeWithChecksums(c fileChecksums) error {
+	if dw.openCopy {
+		dw.endCopy()
+	}
+
+	dw.b.WriteByte(RS_OP_END)
+	writeChecksums(dw.b, c)
+	return dw.b.Flush()
+}
+
+// AddLiteral writes literal command to buffer
+func (dw *RdiffDelta) AddLiteral(data []byte) {
+	if dw.openCopy {
+		dw.endCopy()
+	}
+
+	if len(data) == 0 {
+		return
+	}
+
+	if len(data) <= int(RS_OP_LITERAL_64) {
+		// Length is the command itself
+		dw.b.WriteByte(RS_OP_LITERAL_1 + uint8(len(data)-1))
+	} else {
+		lengthIdx := intSizeIdx(uint64(len(data)))
+
+		dw.b.WriteByte(RS_OP_LITERAL_N1 + lengthIdx)
+		dw.writeInt(uint64(len(data)), lengthIdx)
+	}
+
+	dw.b.Write(data)
+}
+
+// AddCopy writes copy command to buffer
+func (dw *RdiffDelta) AddCopy(start, length uint64) {
+	if dw.openCopy && dw.start+dw.length != start {
+		dw.endCopy()
+	}
+
+	if !dw.openCopy {
+		dw.openCopy = true
+		dw.start = start
+		dw.length = 0
+	}
+	dw.length += length
+}
+
+// endCopy writes the combined COPY command to buffer
+func (dw *RdiffDelta) endCopy() {
+	startIdx := intSizeIdx(dw.start)
+	lengthIdx := intSizeIdx(dw.length)
+
+	dw.b.WriteByte(RS_OP_COPY_N1_N1 + 4*startIdx + lengthIdx)
+	dw.writeInt(dw.start, startIdx)
+	dw.writeInt(dw.length, lengthIdx)
+
+	dw.openCopy = false
+	dw.start, dw.length = 0, 0
+}
+
+// writeInt writes v to buffer as big endian integer of 1<<sizeIdx bytes
+func (dw *RdiffDelta) writeInt(v uint64, sizeIdx uint8) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+
+	dw.b.Write(b[8-1<<sizeIdx:])
+}
+
+// intSizeIdx returns the index of the smallest integer size (1, 2, 4 or 8 bytes) that fits v
+func intSizeIdx(v uint64) uint8 {
+	switch {
+	case v <= math.MaxUint8:
+		return 0
+	case v <= math.MaxUint16:
+		return 1
+	case v <= math.MaxUint32:
+		return 2
+	default:
+		return 3
+	}
+}
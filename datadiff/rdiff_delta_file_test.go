@@ -0,0 +1,85 @@
+package datadiff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRdiffDelta(t *testing.T) {
+	var tests = []struct {
+		name     string
+		commands func(dw DeltaBuffer)
+		expected []byte
+	}{
+		{
+			name:     "Empty delta",
+			commands: func(dw DeltaBuffer) {},
+			expected: joinChunks(RS_DELTA_MAGIC, "\x00"),
+		},
+		{
+			name: "Short literals have length in command",
+			commands: func(dw DeltaBuffer) {
+				dw.AddLiteral([]byte("a"))
+				dw.AddLiteral(nil)
+				dw.AddLiteral(bytes.Repeat([]byte("b"), 64))
+			},
+			expected: joinChunks(RS_DELTA_MAGIC, "\x01a", "\x40", strings.Repeat("b", 64), "\x00"),
+		},
+		{
+			name: "Long literals",
+			commands: func(dw DeltaBuffer) {
+				dw.AddLiteral(bytes.Repeat([]byte("c"), 65))
+				dw.AddLiteral(bytes.Repeat([]byte("d"), 256))
+				dw.AddLiteral(bytes.Repeat([]byte("e"), 1<<16))
+			},
+			expected: joinChunks(RS_DELTA_MAGIC,
+				"\x41\x41", strings.Repeat("c", 65),
+				"\x42\x01\x00", strings.Repeat("d", 256),
+				"\x43\x00\x01\x00\x00", strings.Repeat("e", 1<<16),
+				"\x00"),
+		},
+		{
+			name: "Copies use smallest start and length",
+			commands: func(dw DeltaBuffer) {
+				dw.AddCopy(0, 1)
+				dw.AddCopy(0x1234, 0x12)
+				dw.AddCopy(0x12345678, 0x123456)
+				dw.AddCopy(0x123456789a, 0xff)
+				dw.AddCopy(0x12, 0x123456789a)
+			},
+			expected: joinChunks(RS_DELTA_MAGIC,
+				"\x45\x00\x01",
+				"\x49\x12\x34\x12",
+				"\x4f\x12\x34\x56\x78\x00\x12\x34\x56",
+				"\x51\x00\x00\x00\x12\x34\x56\x78\x9a\xff",
+				"\x48\x12\x00\x00\x00\x12\x34\x56\x78\x9a",
+				"\x00"),
+		},
+		{
+			name: "Consecutive copies are combined",
+			commands: func(dw DeltaBuffer) {
+				dw.AddCopy(0x10, 0x80)
+				dw.AddCopy(0x90, 0x80)
+				dw.AddLiteral([]byte("f"))
+				dw.AddCopy(0x110, 0x10)
+			},
+			expected: joinChunks(RS_DELTA_MAGIC, "\x46\x10\x01\x00", "\x01f", "\x49\x01\x10\x10", "\x00"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+
+			dw := NewRdiffDelta(buf)
+			tt.commands(dw)
+
+			err := dw.Close()
+			assert.NoError(t, err, "Close should not return error")
+			assert.Equal(t, tt.expected, buf.Bytes(), "Delta should be as expected")
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package datadiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/md4"
+)
+
+const (
+	// Signature magics of librsync that use rollsum weak checksum
+	RS_MD4_SIG_MAGIC    = uint32(0x72730136)
+	RS_BLAKE2_SIG_MAGIC = uint32(0x72730137)
+
+	RS_DEFAULT_BLOCK_LEN = 2048
+
+	RS_MD4_SUM_LENGTH    = md4.Size
+	RS_BLAKE2_SUM_LENGTH = blake2b.Size256
+)
+
+// isRdiffSignature tells whether head is the start of librsync signature
+func isRdiffSignature(head []byte) bool {
+	if len(head) < 4 {
+		return false
+	}
+
+	switch binary.BigEndian.Uint32(head) {
+	case RS_MD4_SIG_MAGIC, RS_BLAKE2_SIG_MAGIC:
+		return true
+	}
+
+	return false
+}
+
+// rdiffParams describes librsync signature
+type rdiffParams struct {
+	magic     uint32
+	blockLen  int
+	strongLen int
+}
+
+// newRdiffParams creates rdiffParams for strong hash with name ("md4" or "blake2b"). Zero strongLen uses the full
+// strong sum.
+func newRdiffParams(name string, blockLen, strongLen int) (rdiffParams, error) {
+	var p = rdiffParams{
+		blockLen:  blockLen,
+		strongLen: strongLen,
+	}
+
+	switch strings.ToLower(name) {
+	case "md4":
+		p.magic = RS_MD4_SIG_MAGIC
+	case "blake2b", "blake2":
+		p.magic = RS_BLAKE2_SIG_MAGIC
+	default:
+		return p, fmt.Errorf("unknown rdiff strong hash: %s (supported: md4, blake2b)", name)
+	}
+
+	if p.strongLen == 0 {
+		p.strongLen = p.maxStrongLen()
+	}
+
+	return p, p.validate()
+}
+
+// maxStrongLen returns the size of full strong sum
+func (p rdiffParams) maxStrongLen() int {
+	if p.magic == RS_MD4_SIG_MAGIC {
+		return RS_MD4_SUM_LENGTH
+	}
+
+	return RS_BLAKE2_SUM_LENGTH
+}
+
+// validate checks that signature can be used
+func (p rdiffParams) validate() error {
+	if p.magic != RS_MD4_SIG_MAGIC && p.magic != RS_BLAKE2_SIG_MAGIC {
+		return fmt.Errorf("unsupported rdiff signature magic: 0x%08x", p.magic)
+	}
+	if p.blockLen < 1 || p.blockLen > chunkSizeLimit {
+		return fmt.Errorf("block size has to be between 1 and %d: %d", chunkSizeLimit, p.blockLen)
+	}
+	if p.strongLen < 1 || p.strongLen > p.maxStrongLen() {
+		return fmt.Errorf("strong sum size has to be between 1 and %d: %d", p.maxStrongLen(), p.strongLen)
+	}
+
+	return nil
+}
+
+// newStrongHash creates strong hash of signature blocks
+func (p rdiffParams) newStrongHash() hash.Hash {
+	if p.magic == RS_MD4_SIG_MAGIC {
+		return md4.New()
+	}
+
+	// Error is returned only for too long key
+	h, _ := blake2b.New256(nil)
+	return h
+}
+
+// rdiffBlock is a block of basis file in librsync signature
+type rdiffBlock struct {
+	weak   uint32
+	strong []byte
+}
+
+// writeRdiffSignatureHeader writes header of librsync signature to w
+func writeRdiffSignatureHeader(w io.Writer, p rdiffParams) error {
+	var b [12]byte
+	binary.BigEndian.PutUint32(b[0:], p.magic)
+	binary.BigEndian.PutUint32(b[4:], uint32(p.blockLen))
+	binary.BigEndian.PutUint32(b[8:], uint32(p.strongLen))
+
+	_, err := w.Write(b[:])
+	return err
+}
+
+// writeRdiffBlock writes single block of librsync signature to w
+func writeRdiffBlock(w io.Writer, block rdiffBlock) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], block.weak)
+
+	_, err := w.Write(b[:])
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(block.strong)
+	return err
+}
+
+// readRdiffSignature reads librsync signature from r
+func readRdiffSignature(r io.Reader) (p rdiffParams, blocks []rdiffBlock, err error) {
+	var b [12]byte
+
+	_, err = io.ReadFull(r, b[:])
+	if err != nil {
+		err = fmt.Errorf("failed to read rdiff signature header: %s", err.Error())
+		return
+	}
+
+	p.magic = binary.BigEndian.Uint32(b[0:])
+	p.blockLen = int(binary.BigEndian.Uint32(b[4:]))
+	p.strongLen = int(binary.BigEndian.Uint32(b[8:]))
+
+	err = p.validate()
+	if err != nil {
+		err = fmt.Errorf("invalid rdiff signature: %s", err.Error())
+		return
+	}
+
+	for i := 0; ; i++ {
+		var block rdiffBlock
+
+		_, err = io.ReadFull(r, b[:4])
+		if err == io.EOF {
+			// Blocks continue until end of file
+			err = nil
+			return
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to read [%d] block weak sum: %s", i, err.Error())
+			return
+		}
+		block.weak = binary.BigEndian.Uint32(b[:4])
+
+		block.strong = make([]byte, p.strongLen)
+		_, err = io.ReadFull(r, block.strong)
+		if err != nil {
+			err = fmt.Errorf("failed to read [%d] block strong sum: %s", i, err.Error())
+			return
+		}
+
+		blocks = append(blocks, block)
+	}
+}
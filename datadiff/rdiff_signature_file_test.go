@@ -0,0 +1,119 @@
+package datadiff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRdiffSignature(t *testing.T) {
+	var tests = []struct {
+		name      string
+		hash      string
+		blockLen  int
+		strongLen int
+		data      []byte
+		expected  []byte
+	}{
+		{
+			name:     "MD4 signature",
+			hash:     "md4",
+			blockLen: 3,
+			data:     []byte("abcabc"),
+			// MD4 of "abc" is from RFC 1320
+			expected: joinChunks(
+				"rs\x016", "\x00\x00\x00\x03", "\x00\x00\x00\x10",
+				"\x03\x04\x01\x83", "\xa4\x48\x01\x7a\xaf\x21\xd8\x52\x5f\xc1\x0a\xe8\x7a\xa6\x72\x9d",
+				"\x03\x04\x01\x83", "\xa4\x48\x01\x7a\xaf\x21\xd8\x52\x5f\xc1\x0a\xe8\x7a\xa6\x72\x9d",
+			),
+		},
+		{
+			name:      "Truncated BLAKE2 signature",
+			hash:      "blake2b",
+			blockLen:  3,
+			strongLen: 8,
+			data:      []byte("abcabc"),
+			expected: joinChunks(
+				"rs\x017", "\x00\x00\x00\x03", "\x00\x00\x00\x08",
+				"\x03\x04\x01\x83", "\xbd\xdd\x81\x3c\x63\x42\x39\x72",
+				"\x03\x04\x01\x83", "\xbd\xdd\x81\x3c\x63\x42\x39\x72",
+			),
+		},
+		{
+			name:     "Block shorter than block size",
+			hash:     "md4",
+			blockLen: 4,
+			data:     []byte("abc"),
+			expected: joinChunks(
+				"rs\x016", "\x00\x00\x00\x04", "\x00\x00\x00\x10",
+				"\x03\x04\x01\x83", "\xa4\x48\x01\x7a\xaf\x21\xd8\x52\x5f\xc1\x0a\xe8\x7a\xa6\x72\x9d",
+			),
+		},
+		{
+			name:     "Empty file",
+			hash:     "md4",
+			blockLen: 2048,
+			data:     nil,
+			expected: joinChunks("rs\x016", "\x00\x00\x08\x00", "\x00\x00\x00\x10"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newRdiffParams(tt.hash, tt.blockLen, tt.strongLen)
+			assert.NoError(t, err, "newRdiffParams should not return error")
+
+			sig := &bytes.Buffer{}
+			err = createRdiffSignature(bytes.NewReader(tt.data), sig, p)
+			assert.NoError(t, err, "createRdiffSignature should not return error")
+			assert.Equal(t, tt.expected, sig.Bytes(), "Signature should be as expected")
+
+			gotP, blocks, err := readRdiffSignature(sig)
+			assert.NoError(t, err, "readRdiffSignature should not return error")
+			assert.Equal(t, p, gotP, "Read parameters should equal to written ones")
+			assert.Len(t, blocks, (len(tt.data)+tt.blockLen-1)/tt.blockLen, "Signature should have block for each block of data")
+		})
+	}
+}
+
+func TestReadRdiffSignatureErrors(t *testing.T) {
+	var tests = []struct {
+		name        string
+		data        []byte
+		expectedErr string
+	}{
+		{
+			name:        "RabinKarp signature",
+			data:        joinChunks("rs\x01\x47", "\x00\x00\x08\x00", "\x00\x00\x00\x20"),
+			expectedErr: "invalid rdiff signature: unsupported rdiff signature magic: 0x72730147",
+		},
+		{
+			name:        "Too long strong sum",
+			data:        joinChunks("rs\x016", "\x00\x00\x08\x00", "\x00\x00\x00\x20"),
+			expectedErr: "invalid rdiff signature: strong sum size has to be between 1 and 16: 32",
+		},
+		{
+			name:        "Zero block size",
+			data:        joinChunks("rs\x017", "\x00\x00\x00\x00", "\x00\x00\x00\x20"),
+			expectedErr: "invalid rdiff signature: block size has to be between 1 and 67108864: 0",
+		},
+		{
+			name:        "Truncated header",
+			data:        joinChunks("rs\x017", "\x00\x00\x08\x00"),
+			expectedErr: "failed to read rdiff signature header: unexpected EOF",
+		},
+		{
+			name:        "Truncated block",
+			data:        joinChunks("rs\x016", "\x00\x00\x08\x00", "\x00\x00\x00\x04", "\x01\x02\x03\x04", "\x01\x02"),
+			expectedErr: "failed to read [0] block strong sum: unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readRdiffSignature(bytes.NewReader(tt.data))
+			assert.EqualError(t, err, tt.expectedErr)
+		})
+	}
+}
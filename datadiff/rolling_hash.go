@@ -0,0 +1,62 @@
+package datadiff
+
+const (
+	windowSize = 16
+
+	pM = uint64(1000000009)
+)
+
+// shiftMultiplier is used to precalculate last byte's multiplier in rolling hash window
+func shiftMultiplier() (m uint64) {
+	m = 256
+
+	for i := 2; i < windowSize; i++ {
+		m = (m % pM) * 256
+	}
+
+	return
+}
+
+var shiftM = shiftMultiplier()
+
+// shiftTable contains for each byte value the amount it adds to hash while it is the first byte in the window.
+// It saves a modulo operation per byte when the byte is removed from the window.
+var shiftTable = func() (t [256]uint64) {
+	for b := 0; b < len(t); b++ {
+		t[b] = uint64(b) * shiftM % pM
+	}
+
+	return
+}()
+
+// calcRollingHash calculates rolling hash of each window of data and appends them to hashes. The hash of
+// window ending to data[i] is at index i-(windowSize-1) of appended hashes. Data shorter than windowSize has no
+// windows, so nothing is appended.
+func calcRollingHash(data []byte, hashes []uint64) []uint64 {
+	if len(data) < windowSize {
+		return hashes
+	}
+
+	var hash uint64
+	var i int
+	var l = len(data)
+
+	hash = uint64(data[0])
+
+	for i = 1; i < windowSize; i++ {
+		hash = (hash * 256) % pM
+
+		hash = (hash + uint64(data[i])) % pM
+	}
+
+	hashes = append(hashes, hash)
+
+	for i = windowSize; i < l; i++ {
+		// Adding pM keeps the subtraction positive
+		hash = ((hash+pM-shiftTable[data[i-windowSize]])*256 + uint64(data[i])) % pM
+
+		hashes = append(hashes, hash)
+	}
+
+	return hashes
+}
@@ -0,0 +1,96 @@
+package datadiff
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcRollingHash(t *testing.T) {
+	var tests = []struct {
+		name       string
+		data       []byte
+		assertHash func(t *testing.T, n uint64)
+	}{
+		{
+			name: "256 slice with only 0x00 values",
+			data: (func() []byte {
+				var d = make([]byte, 256)
+
+				for i := 0; i < len(d); i++ {
+					d[i] = 0x00
+				}
+
+				return d
+			}()),
+			assertHash: func(t *testing.T, n uint64) {
+				assert.Equal(t, uint64(0), n, "hash should be equal to 0")
+			},
+		},
+		{
+			name: "256 slice with only 0xff values",
+			data: (func() []byte {
+				var d = make([]byte, 256)
+
+				for i := 0; i < len(d); i++ {
+					d[i] = 0xff
+				}
+
+				return d
+			}()),
+			assertHash: func(t *testing.T, n uint64) {
+				assert.Equal(t, uint64(0x21eabe90), n, "hash should be equal to 0")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hashes := calcRollingHash(tt.data, nil)
+
+			assert.Len(t, hashes, len(tt.data)-windowSize+1, "There should be hash for each window")
+
+			for _, n := range hashes {
+				tt.assertHash(t, n)
+			}
+		})
+	}
+}
+
+func TestCalcRollingHashWindow(t *testing.T) {
+	var data = make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	hashes := calcRollingHash(data, nil)
+
+	for i := windowSize - 1; i < len(data); i++ {
+		// Rolled hash should equal to hash calculated from the window only
+		window := calcRollingHash(data[i-windowSize+1:i+1], nil)
+
+		assert.Equal(t, window[0], hashes[i-windowSize+1], "Hash of window ending at %d should match", i)
+	}
+}
+
+func TestCalcRollingHashShortData(t *testing.T) {
+	for _, size := range []int{0, 1, windowSize - 1} {
+		hashes := calcRollingHash(make([]byte, size), []uint64{7})
+
+		assert.Equal(t, []uint64{7}, hashes, "Data of %d bytes should have no windows", size)
+	}
+
+	assert.Len(t, calcRollingHash(make([]byte, windowSize), nil), 1, "Data of window size should have one window")
+}
+
+func BenchmarkCalcRollingHash(b *testing.B) {
+	var data = make([]byte, 1<<20)
+	var hashes = make([]uint64, 0, len(data))
+	rand.New(rand.NewSource(1)).Read(data)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		hashes = calcRollingHash(data, hashes[:0])
+	}
+}
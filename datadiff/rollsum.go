@@ -0,0 +1,46 @@
+package datadiff
+
+// ROLLSUM_CHAR_OFFSET is added to each byte like librsync does, so that runs of zero bytes affect the checksum
+const ROLLSUM_CHAR_OFFSET = 31
+
+// rollsum is the weak checksum of librsync signatures. It is a variant of rsync's rolling checksum.
+type rollsum struct {
+	count uint32
+	s1    uint32
+	s2    uint32
+}
+
+// update adds data to the end of checksum window
+func (rs *rollsum) update(data []byte) {
+	for _, b := range data {
+		rs.s1 += uint32(b) + ROLLSUM_CHAR_OFFSET
+		rs.s2 += rs.s1
+	}
+	rs.count += uint32(len(data))
+}
+
+// rotate removes out byte from the start and adds in byte to the end of checksum window
+func (rs *rollsum) rotate(out, in byte) {
+	rs.s1 += uint32(in) - uint32(out)
+	rs.s2 += rs.s1 - rs.count*(uint32(out)+ROLLSUM_CHAR_OFFSET)
+}
+
+// rollout removes out byte from the start of checksum window
+func (rs *rollsum) rollout(out byte) {
+	rs.s1 -= uint32(out) + ROLLSUM_CHAR_OFFSET
+	rs.s2 -= rs.count * (uint32(out) + ROLLSUM_CHAR_OFFSET)
+	rs.count--
+}
+
+// digest returns the checksum of window
+func (rs *rollsum) digest() uint32 {
+	return rs.s2<<16 | rs.s1&0xffff
+}
+
+// calcRollsum returns the checksum of data
+func calcRollsum(data []byte) uint32 {
+	var rs rollsum
+	rs.update(data)
+
+	return rs.digest()
+}
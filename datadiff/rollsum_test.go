@@ -0,0 +1,74 @@
+package datadiff
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcRollsum(t *testing.T) {
+	var tests = []struct {
+		name     string
+		data     []byte
+		expected uint32
+	}{
+		{
+			name:     "Empty data",
+			data:     nil,
+			expected: 0,
+		},
+		{
+			name: "Single byte",
+			// s1 = 'a'+31, s2 = s1
+			data:     []byte("a"),
+			expected: 0x00800080,
+		},
+		{
+			name: "Three bytes",
+			// s1 = 128+129+130, s2 = 128+257+387
+			data:     []byte("abc"),
+			expected: 0x03040183,
+		},
+		{
+			name: "Zero bytes",
+			// s1 = 4*31, s2 = 31+62+93+124
+			data:     []byte{0, 0, 0, 0},
+			expected: 0x0136007c,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, calcRollsum(tt.data), "Rollsum should be as expected")
+		})
+	}
+}
+
+func TestRollsumRotate(t *testing.T) {
+	var data = make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	const blockLen = 100
+
+	var rs rollsum
+	rs.update(data[:blockLen])
+
+	for i := 1; i+blockLen <= len(data); i++ {
+		rs.rotate(data[i-1], data[i+blockLen-1])
+		assert.Equal(t, calcRollsum(data[i:i+blockLen]), rs.digest(), "Rotated rollsum should equal to calculated one")
+	}
+}
+
+func TestRollsumRollout(t *testing.T) {
+	var data = make([]byte, 100)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	var rs rollsum
+	rs.update(data)
+
+	for i := 1; i <= len(data); i++ {
+		rs.rollout(data[i-1])
+		assert.Equal(t, calcRollsum(data[i:]), rs.digest(), "Rollsum should equal to calculated one of remaining data")
+	}
+}
@@ -0,0 +1,458 @@
+package datadiff
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	// signatureMagic starts signature files since version 2. Version 1 signatures start directly with 32 bit chunk
+	// count, which can never be equal to signatureMagic as maximum 4 GiB file does not have that many chunks.
+	signatureMagic = "DDSG"
+
+	// Version 2 has no signatureHeader. Its chunks were resolved with the default parameters.
+	signatureVersionNoHeader = uint32(2)
+
+	// Version 3 header has no chunking algorithm. Its chunks were resolved with polynomial rolling hash.
+	signatureVersionPolynomial = uint32(3)
+	signatureVersion           = uint32(4)
+)
+
+// signatureHeader contains the parameters with which chunks of signature were resolved. Delta has to be created with
+// same parameters, otherwise chunks of new file would not match chunks of basis file.
+type signatureHeader struct {
+	windowSize uint32
+
+	chunkParams
+	hashParams
+
+	// checksum of whole basis file from the checksum trailer or nil if signature has none
+	checksum []byte
+}
+
+// newSignatureHeader creates header for signature which chunks are resolved with p and hashed with hp
+func newSignatureHeader(p chunkParams, hp hashParams) signatureHeader {
+	// Unknown algorithm is noticed when chunker is created
+	a, _ := p.chunkAlgorithm()
+
+	return signatureHeader{
+		windowSize:  uint32(a.window),
+		chunkParams: p,
+		hashParams:  hp,
+	}
+}
+
+// check returns error if chunks of signature can not be resolved with this version
+func (h signatureHeader) check() error {
+	a, err := h.chunkParams.chunkAlgorithm()
+	if err != nil {
+		return unsupportedSignature("signature uses %s", err.Error())
+	}
+
+	if h.windowSize != uint32(a.window) {
+		return unsupportedSignature("signature uses rolling hash window size %d, expected %d", h.windowSize, a.window)
+	}
+
+	_, err = a.rollingHash(h.chunkParams)
+	if err != nil {
+		return corruptSignature("signature has invalid rolling hash: %s", err.Error())
+	}
+
+	_, err = h.hashParams.strongHash()
+	if err != nil {
+		return unsupportedSignature("signature uses %s", err.Error())
+	}
+
+	err = h.chunkParams.validate()
+	if err != nil {
+		return corruptSignature("signature has invalid chunk parameters: %s", err.Error())
+	}
+
+	return nil
+}
+
+// signatureWriter writes chunks to signature file.
+//
+// Signature consists of signatureMagic, version and signatureHeader followed by chunks. Header ends with the rolling
+// hash parameters of chunking algorithms that have them. Each chunk has 64 bit start, size and stopChecksum and the
+// chunk hash. Chunks end with start equal to basis file size and zero size, so the signature can be written while
+// chunks are being resolved. Checksum trailer of basis file follows the end of chunks.
+type signatureWriter struct {
+	w   io.Writer
+	end uint64
+}
+
+// newSignatureWriter writes signature header h to w
+func newSignatureWriter(w io.Writer, h signatureHeader) (*signatureWriter, error) {
+	var b [4 + 4 + 20 + 3]byte
+
+	copy(b[0:], signatureMagic)
+	binary.BigEndian.PutUint32(b[4:], signatureVersion)
+	binary.BigEndian.PutUint32(b[8:], h.windowSize)
+	binary.BigEndian.PutUint32(b[12:], uint32(h.minSize))
+	binary.BigEndian.PutUint32(b[16:], uint32(h.maxSize))
+	binary.BigEndian.PutUint64(b[20:], h.separator)
+	b[28] = h.hashParams.id
+	b[29] = h.hashParams.size
+	b[30] = h.algorithm
+
+	_, err := w.Write(b[:])
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeChunkAlgorithmParams(w, h.chunkParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signatureWriter{w: w}, nil
+}
+
+// writeChunk writes single chunk to signature
+func (sw *signatureWriter) writeChunk(c chunk) error {
+	var b [24]byte
+	binary.BigEndian.PutUint64(b[0:], c.start)
+	binary.BigEndian.PutUint64(b[8:], c.size)
+	binary.BigEndian.PutUint64(b[16:], c.stopChecksum)
+
+	_, err := sw.w.Write(b[:])
+	if err != nil {
+		return err
+	}
+
+	_, err = sw.w.Write(c.hash)
+	if err != nil {
+		return err
+	}
+
+	sw.end = c.start + c.size
+	return nil
+}
+
+// close writes the end of chunks and checksum of basis file if it is not nil
+func (sw *signatureWriter) close(checksum []byte) error {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[0:], sw.end)
+
+	_, err := sw.w.Write(b[:])
+	if err != nil || checksum == nil {
+		return err
+	}
+
+	return writeChecksums(sw.w, fileChecksums{basis: checksum})
+}
+
+// Errors of invalid signatures. Errors returned for signatures match them with errors.Is.
+var (
+	// ErrCorruptSignature is matched by errors of truncated or inconsistent signatures
+	ErrCorruptSignature = errors.New("corrupt signature")
+
+	// ErrUnsupportedSignature is matched by errors of signatures with unknown version or parameters
+	ErrUnsupportedSignature = errors.New("unsupported signature")
+)
+
+// signatureError is error of invalid signature which matches kind
+type signatureError struct {
+	kind error
+	msg  string
+}
+
+func (e *signatureError) Error() string {
+	return e.msg
+}
+
+func (e *signatureError) Unwrap() error {
+	return e.kind
+}
+
+// corruptSignature returns ErrCorruptSignature error with formatted message
+func corruptSignature(format string, a ...interface{}) error {
+	return &signatureError{kind: ErrCorruptSignature, msg: fmt.Sprintf(format, a...)}
+}
+
+// unsupportedSignature returns ErrUnsupportedSignature error with formatted message
+func unsupportedSignature(format string, a ...interface{}) error {
+	return &signatureError{kind: ErrUnsupportedSignature, msg: fmt.Sprintf(format, a...)}
+}
+
+// readError returns error of failed read of what. Signature ending too early is corrupt.
+func readError(err error, format string, a ...interface{}) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return corruptSignature("failed to read "+format+": %s", append(a, err.Error())...)
+	}
+
+	return fmt.Errorf("failed to read "+format+": %s", append(a, err.Error())...)
+}
+
+// remainingSize returns the number of bytes left in r or -1 if it is not known
+func remainingSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		// bytes.Reader, bytes.Buffer and strings.Reader
+		return int64(r.Len())
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+
+		return info.Size() - offset
+	}
+
+	return -1
+}
+
+// maxChunkPrealloc limits the chunks allocated before they are read, as chunk count of signature is not trusted
+const maxChunkPrealloc = 64 * 1024
+
+// readSignature reads from r io.Reader signature header and slice of chunks that makes a signature file. Error is
+// returned if chunks of signature can not be resolved with this version. Size of signature is used to validate chunk
+// count if it is not negative.
+func readSignature(r io.Reader, size int64) (h signatureHeader, chunks []chunk, err error) {
+	var head [4]byte
+
+	_, err = io.ReadFull(r, head[:])
+	if err != nil {
+		err = readError(err, "signature header")
+		return
+	}
+
+	h = newSignatureHeader(defaultChunkParams, defaultHashParams)
+
+	if string(head[:]) != signatureMagic {
+		// Version 1 signature starts with the chunk count
+		chunks, err = readSignatureLegacy(r, binary.BigEndian.Uint32(head[:]), size-int64(len(head)))
+		return
+	}
+
+	var b [8]byte
+	_, err = io.ReadFull(r, b[:4])
+	if err != nil {
+		err = readError(err, "signature version")
+		return
+	}
+
+	switch version := binary.BigEndian.Uint32(b[:4]); version {
+	case signatureVersionNoHeader:
+	case signatureVersionPolynomial, signatureVersion:
+		h, err = readSignatureHeader(r, version)
+		if err != nil {
+			err = readError(err, "signature header")
+			return
+		}
+	default:
+		err = unsupportedSignature("unsupported signature version: %d", version)
+		return
+	}
+
+	err = h.check()
+	if err != nil {
+		return
+	}
+
+	var end uint64 // End of previous chunk
+	for i := 0; ; i++ {
+		var c chunk
+
+		_, err = io.ReadFull(r, b[:])
+		if err != nil {
+			err = readError(err, "[%d] chunk start", i)
+			return
+		}
+		c.start = binary.BigEndian.Uint64(b[:])
+
+		_, err = io.ReadFull(r, b[:])
+		if err != nil {
+			err = readError(err, "[%d] chunk size", i)
+			return
+		}
+		c.size = binary.BigEndian.Uint64(b[:])
+
+		if c.size == 0 {
+			// End of chunks is at the end of last chunk
+			if c.start != end {
+				err = corruptSignature("end of chunks %d differs from end of last chunk %d", c.start, end)
+				return
+			}
+
+			var sums fileChecksums
+			sums, err = readChecksums(r)
+			if err != nil {
+				err = corruptSignature("invalid checksum of basis file: %s", err.Error())
+			}
+			h.checksum = sums.basis
+			return
+		}
+
+		err = checkChunk(i, c, end)
+		if err != nil {
+			return
+		}
+		end = c.start + c.size
+
+		_, err = io.ReadFull(r, b[:])
+		if err != nil {
+			err = readError(err, "[%d] chunk stopChecksum", i)
+			return
+		}
+		c.stopChecksum = binary.BigEndian.Uint64(b[:])
+
+		c.hash = make([]byte, h.hashParams.size)
+		_, err = io.ReadFull(r, c.hash)
+		if err != nil {
+			err = readError(err, "[%d] chunk hash", i)
+			return
+		}
+
+		c.number = i
+		chunks = append(chunks, c)
+	}
+}
+
+// checkChunk checks that chunk i starts after end of previous chunk and its end fits in 64 bits
+func checkChunk(i int, c chunk, end uint64) error {
+	if c.start < end {
+		return corruptSignature("[%d] chunk start %d overlaps previous chunk ending at %d", i, c.start, end)
+	}
+	if c.start+c.size < c.start {
+		return corruptSignature("[%d] chunk end overflows: start %d, size %d", i, c.start, c.size)
+	}
+
+	return nil
+}
+
+// readSignatureHeader reads signatureHeader that follows signature version
+func readSignatureHeader(r io.Reader, version uint32) (h signatureHeader, err error) {
+	var b [20 + 3]byte
+	var l = len(b)
+	if version == signatureVersionPolynomial {
+		l--
+	}
+
+	_, err = io.ReadFull(r, b[:l])
+	if err != nil {
+		return
+	}
+
+	h.windowSize = binary.BigEndian.Uint32(b[0:])
+	h.minSize = int(binary.BigEndian.Uint32(b[4:]))
+	h.maxSize = int(binary.BigEndian.Uint32(b[8:]))
+	h.separator = binary.BigEndian.Uint64(b[12:])
+	h.hashParams.id = b[20]
+	h.hashParams.size = b[21]
+	h.algorithm = b[22]
+
+	if version == signatureVersion {
+		err = readChunkAlgorithmParams(r, &h.chunkParams)
+	}
+
+	return
+}
+
+// writeChunkAlgorithmParams writes rolling hash parameters of the chunking algorithm of p
+func writeChunkAlgorithmParams(w io.Writer, p chunkParams) error {
+	var b []byte
+
+	switch p.algorithm {
+	case chunkerRabin:
+		b = make([]byte, 8)
+		binary.BigEndian.PutUint64(b, p.polynomial)
+	case chunkerBuzhash:
+		b = make([]byte, 4*len(p.table))
+		for i, v := range p.table {
+			binary.BigEndian.PutUint32(b[4*i:], v)
+		}
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+// readChunkAlgorithmParams reads rolling hash parameters of the chunking algorithm of p. Unknown algorithms have no
+// parameters.
+func readChunkAlgorithmParams(r io.Reader, p *chunkParams) error {
+	switch p.algorithm {
+	case chunkerRabin:
+		var b [8]byte
+		_, err := io.ReadFull(r, b[:])
+		if err != nil {
+			return err
+		}
+
+		p.polynomial = binary.BigEndian.Uint64(b[:])
+	case chunkerBuzhash:
+		var b [4 * len(buzhashTable{})]byte
+		_, err := io.ReadFull(r, b[:])
+		if err != nil {
+			return err
+		}
+
+		p.table = &buzhashTable{}
+		for i := range p.table {
+			p.table[i] = binary.BigEndian.Uint32(b[4*i:])
+		}
+	}
+
+	return nil
+}
+
+// legacyChunkSize is the size of chunk in version 1 signature
+const legacyChunkSize = 4 + 4 + 8 + sha1.Size
+
+// readSignatureLegacy reads count chunks of version 1 signature which has 32 bit chunk starts and sizes. Count is
+// validated against size of remaining signature if it is not negative.
+func readSignatureLegacy(r io.Reader, count uint32, size int64) (chunks []chunk, err error) {
+	if size >= 0 && int64(count)*legacyChunkSize != size {
+		err = corruptSignature("signature of %d chunks has to be %d bytes long, remaining size is %d", count,
+			int64(count)*legacyChunkSize, size)
+		return
+	}
+
+	var prealloc = count
+	if prealloc > maxChunkPrealloc {
+		prealloc = maxChunkPrealloc
+	}
+	chunks = make([]chunk, 0, prealloc)
+
+	var b [legacyChunkSize]byte
+	var end uint64
+	for i := 0; i < int(count); i++ {
+		_, err = io.ReadFull(r, b[:])
+		if err != nil {
+			err = readError(err, "[%d] chunk", i)
+			return
+		}
+
+		c := chunk{
+			start:        uint64(binary.BigEndian.Uint32(b[0:])),
+			size:         uint64(binary.BigEndian.Uint32(b[4:])),
+			stopChecksum: binary.BigEndian.Uint64(b[8:]),
+			hash:         append([]byte(nil), b[16:]...),
+			number:       i,
+		}
+		if c.size == 0 {
+			err = corruptSignature("[%d] chunk is empty", i)
+			return
+		}
+
+		err = checkChunk(i, c, end)
+		if err != nil {
+			return
+		}
+		end = c.start + c.size
+
+		chunks = append(chunks, c)
+	}
+
+	return
+}
@@ -0,0 +1,390 @@
+package datadiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signatureHeaderBytes returns start of signature with header h
+func signatureHeaderBytes(h signatureHeader) []byte {
+	buf := &bytes.Buffer{}
+
+	newSignatureWriter(buf, h)
+
+	return buf.Bytes()
+}
+
+// signatureCurrent converts version 1 signature to current version with default header
+func signatureCurrent(legacy []byte) []byte {
+	_, chunks, err := readSignature(bytes.NewReader(legacy), int64(len(legacy)))
+	if err != nil {
+		panic(err)
+	}
+
+	data, err := writeSignature(chunks)
+	if err != nil {
+		panic(err)
+	}
+
+	return data
+}
+
+// signatureNoHeader converts version 1 signature to version 2 signature which has no signatureHeader
+func signatureNoHeader(legacy []byte) []byte {
+	data := signatureCurrent(legacy)
+
+	return joinChunks(signatureMagic, "\x00\x00\x00\x02", string(data[len(signatureHeaderBytes(newSignatureHeader(defaultChunkParams, defaultHashParams))):]))
+}
+
+// signatureV3 converts signature of default parameters to version 3 signature which header has no chunking algorithm
+func signatureV3(sig []byte) []byte {
+	var headerSize = len(signatureHeaderBytes(newSignatureHeader(defaultChunkParams, defaultHashParams)))
+
+	return joinChunks(signatureMagic, "\x00\x00\x00\x03", string(sig[8:headerSize-1]), string(sig[headerSize:]))
+}
+
+// writeSignature writes chunks to signature with default header
+func writeSignature(chunks []chunk) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	sw, err := newSignatureWriter(buf, newSignatureHeader(defaultChunkParams, defaultHashParams))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range chunks {
+		err = sw.writeChunk(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = sw.close(nil)
+	return buf.Bytes(), err
+}
+
+func TestSignatureReadWrite(t *testing.T) {
+	var hash = make([]byte, 20)
+	for i := 0; i < len(hash); i++ {
+		hash[i] = byte(i)
+	}
+
+	var chunks = []chunk{
+		{
+			start:        0,
+			size:         1 << 32,
+			stopChecksum: 0x007f,
+			hash:         hash,
+			number:       0,
+		},
+		{
+			start:        1 << 32,
+			size:         1023,
+			stopChecksum: 0x00ff,
+			hash:         hash,
+			number:       1,
+		},
+		{
+			start:        1<<32 + 1023,
+			size:         1<<40 - 1<<32 - 1023,
+			stopChecksum: 0xffff,
+			hash:         hash,
+			number:       2,
+		},
+	}
+
+	data, err := writeSignature(chunks)
+	assert.NoError(t, err, "writeSignature should not return error")
+
+	header, gotChunks, err := readSignature(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err, "readSignature should not return error")
+	assert.Equal(t, newSignatureHeader(defaultChunkParams, defaultHashParams), header, "Read header should equal to written one")
+	assert.Equal(t, chunks, gotChunks, "Read chunks should equal to written ones")
+
+	data, err = writeSignature(nil)
+	assert.NoError(t, err, "writeSignature should not return error")
+
+	_, gotChunks, err = readSignature(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err, "readSignature should not return error")
+	assert.Empty(t, gotChunks, "Signature of empty file should not have chunks")
+}
+
+func TestReadSignatureVersions(t *testing.T) {
+	var tests = []struct {
+		name          string
+		data          []byte
+		expectedCount int
+		expectedErr   string
+	}{
+		{
+			name:          "Version 1 signature without header",
+			data:          signature,
+			expectedCount: 7,
+		},
+		{
+			name:          "Version 2 signature without header",
+			data:          signatureNoHeader(signature),
+			expectedCount: 7,
+		},
+		{
+			name:          "Version 3 signature without chunking algorithm",
+			data:          signatureV3(signatureCurrent(signature)),
+			expectedCount: 7,
+		},
+		{
+			name:        "Unsupported version",
+			data:        []byte(signatureMagic + "\x00\x00\x00\x05"),
+			expectedErr: "unsupported signature version: 5",
+		},
+		{
+			name: "Unknown chunking algorithm",
+			data: signatureHeaderBytes(signatureHeader{
+				windowSize:  16,
+				chunkParams: chunkParams{algorithm: 9, minSize: 32, maxSize: 1024, separator: 0x7f},
+				hashParams:  defaultHashParams,
+			}),
+			expectedErr: "signature uses unknown chunker: 9",
+		},
+		{
+			name:        "Missing chunk end",
+			data:        signatureHeaderBytes(newSignatureHeader(defaultChunkParams, defaultHashParams)),
+			expectedErr: "failed to read [0] chunk start: EOF",
+		},
+		{
+			name: "Different window size",
+			data: signatureHeaderBytes(signatureHeader{
+				windowSize:  32,
+				chunkParams: defaultChunkParams,
+				hashParams:  defaultHashParams,
+			}),
+			expectedErr: "signature uses rolling hash window size 32, expected 16",
+		},
+		{
+			name: "Invalid chunk sizes",
+			data: signatureHeaderBytes(newSignatureHeader(chunkParams{
+				minSize:   1024,
+				maxSize:   32,
+				separator: 0x7f,
+			}, defaultHashParams)),
+			expectedErr: "signature has invalid chunk parameters: maximum chunk size 32 is smaller than minimum chunk size 1024",
+		},
+		{
+			name: "Too large maximum chunk size",
+			data: signatureHeaderBytes(newSignatureHeader(chunkParams{
+				minSize:   32,
+				maxSize:   1 << 31,
+				separator: 0x7f,
+			}, defaultHashParams)),
+			expectedErr: "signature has invalid chunk parameters: maximum chunk size 2147483648 exceeds limit 67108864",
+		},
+		{
+			name: "Unknown strong hash",
+			data: signatureHeaderBytes(signatureHeader{
+				windowSize:  16,
+				chunkParams: defaultChunkParams,
+				hashParams:  hashParams{id: 9, size: 20},
+			}),
+			expectedErr: "signature uses unknown strong hash: 9",
+		},
+		{
+			name: "Reducible rabin polynomial",
+			data: signatureHeaderBytes(newSignatureHeader(chunkParams{
+				algorithm:  chunkerRabin,
+				minSize:    32,
+				maxSize:    1024,
+				separator:  0x7f,
+				polynomial: 1<<53 | 1,
+			}, defaultHashParams)),
+			expectedErr: "signature has invalid rolling hash: rabin polynomial 0x20000000000001 is not irreducible",
+		},
+		{
+			name: "Truncated buzhash table",
+			data: signatureHeaderBytes(newSignatureHeader(chunkParams{
+				algorithm: chunkerBuzhash,
+				minSize:   32,
+				maxSize:   1024,
+				separator: 0x7f,
+				table:     &defaultBuzhashTable,
+			}, defaultHashParams))[:100],
+			expectedErr: "failed to read signature header: unexpected EOF",
+		},
+		{
+			name:        "Truncated header",
+			data:        signatureHeaderBytes(newSignatureHeader(defaultChunkParams, defaultHashParams))[:20],
+			expectedErr: "failed to read signature header: unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, chunks, err := readSignature(bytes.NewReader(tt.data), int64(len(tt.data)))
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "readSignature should not return error")
+			assert.Len(t, chunks, tt.expectedCount, "Signature should have expected amount of chunks")
+		})
+	}
+}
+
+func TestSignatureHeaderChunkerParams(t *testing.T) {
+	table, err := newBuzhashTable(nil, 42)
+	assert.NoError(t, err, "newBuzhashTable should not return error")
+
+	for _, p := range []chunkParams{
+		{algorithm: chunkerRabin, minSize: 32, maxSize: 1024, separator: 0x7f, polynomial: 0x100400007},
+		{algorithm: chunkerBuzhash, minSize: 32, maxSize: 1024, separator: 0x7f, table: table},
+	} {
+		buf := &bytes.Buffer{}
+		sw, err := newSignatureWriter(buf, newSignatureHeader(p, defaultHashParams))
+		assert.NoError(t, err, "newSignatureWriter should not return error")
+		assert.NoError(t, sw.close(nil), "close should not return error")
+
+		h, _, err := readSignature(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err, "readSignature should not return error")
+		assert.Equal(t, p, h.chunkParams, "Chunk parameters should be read from header")
+	}
+}
+
+// chunkRecord returns chunk of version 3 signature with sha1 sized hash
+func chunkRecord(start, size uint64) string {
+	var b [24 + 20]byte
+	binary.BigEndian.PutUint64(b[0:], start)
+	binary.BigEndian.PutUint64(b[8:], size)
+
+	return string(b[:])
+}
+
+func TestReadSignatureCorrupt(t *testing.T) {
+	var header = string(signatureHeaderBytes(newSignatureHeader(defaultChunkParams, defaultHashParams)))
+
+	var tests = []struct {
+		name        string
+		data        []byte
+		size        int64
+		expectedErr string
+	}{
+		{
+			name:        "Legacy chunk count exceeds input",
+			data:        []byte("\xff\xff\xff\xf0"),
+			size:        4,
+			expectedErr: "signature of 4294967280 chunks has to be 154618822080 bytes long, remaining size is 0",
+		},
+		{
+			name:        "Legacy signature with trailing data",
+			data:        joinChunks(string(signature), "x"),
+			size:        int64(len(signature)) + 1,
+			expectedErr: "signature of 7 chunks has to be 252 bytes long, remaining size is 253",
+		},
+		{
+			name:        "Legacy chunk count exceeds input of unknown size",
+			data:        []byte("\xff\xff\xff\xf0"),
+			size:        -1,
+			expectedErr: "failed to read [0] chunk: EOF",
+		},
+		{
+			name:        "Legacy empty chunk",
+			data:        joinChunks("\x00\x00\x00\x01", strings.Repeat("\x00", legacyChunkSize)),
+			size:        4 + legacyChunkSize,
+			expectedErr: "[0] chunk is empty",
+		},
+		{
+			name:        "Truncated chunk hash",
+			data:        joinChunks(header, chunkRecord(0, 100)[:30]),
+			size:        -1,
+			expectedErr: "failed to read [0] chunk hash: unexpected EOF",
+		},
+		{
+			name:        "Overlapping chunks",
+			data:        joinChunks(header, chunkRecord(0, 100), chunkRecord(99, 100), chunkRecord(199, 0)),
+			size:        -1,
+			expectedErr: "[1] chunk start 99 overlaps previous chunk ending at 100",
+		},
+		{
+			name:        "Decreasing chunk start",
+			data:        joinChunks(header, chunkRecord(100, 100), chunkRecord(0, 100), chunkRecord(100, 0)),
+			size:        -1,
+			expectedErr: "[1] chunk start 0 overlaps previous chunk ending at 200",
+		},
+		{
+			name:        "Chunk end overflow",
+			data:        joinChunks(header, chunkRecord(math.MaxUint64-10, 100), chunkRecord(89, 0)),
+			size:        -1,
+			expectedErr: "[0] chunk end overflows: start 18446744073709551605, size 100",
+		},
+		{
+			name:        "End of chunks differs from last chunk",
+			data:        joinChunks(header, chunkRecord(0, 100), chunkRecord(50, 0)),
+			size:        -1,
+			expectedErr: "end of chunks 50 differs from end of last chunk 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readSignature(bytes.NewReader(tt.data), tt.size)
+
+			assert.EqualError(t, err, tt.expectedErr)
+			assert.True(t, errors.Is(err, ErrCorruptSignature), "Error should match ErrCorruptSignature")
+		})
+	}
+}
+
+func TestReadSignatureUnsupported(t *testing.T) {
+	_, _, err := readSignature(strings.NewReader(signatureMagic+"\x00\x00\x00\x09"), -1)
+	assert.True(t, errors.Is(err, ErrUnsupportedSignature), "Unknown version should match ErrUnsupportedSignature")
+	assert.False(t, errors.Is(err, ErrCorruptSignature), "Unknown version should not match ErrCorruptSignature")
+
+	// Typed error is kept when delta wraps it
+	err = Delta(strings.NewReader(signatureMagic+"\x00\x00\x00\x09"), strings.NewReader(""), io.Discard, DeltaOptions{})
+	assert.EqualError(t, err, "failed to read SIGNATURE file: unsupported signature version: 9")
+	assert.True(t, errors.Is(err, ErrUnsupportedSignature), "Delta error should match ErrUnsupportedSignature")
+
+	// Read errors of the input are not signature errors
+	_, _, err = readSignature(iotest.ErrReader(errors.New("disk failure")), -1)
+	assert.EqualError(t, err, "failed to read signature header: disk failure")
+	assert.False(t, errors.Is(err, ErrCorruptSignature), "Read error should not match ErrCorruptSignature")
+}
+
+func FuzzReadSignature(f *testing.F) {
+	valid, err := writeSignature([]chunk{
+		{start: 0, size: 100, hash: make([]byte, 20)},
+		{start: 100, size: 50, hash: make([]byte, 20)},
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(valid)
+	f.Add(signature)
+	f.Add(signatureNoHeader(signature))
+	f.Add([]byte("\xff\xff\xff\xff"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, size := range []int64{int64(len(data)), -1} {
+			_, chunks, err := readSignature(bytes.NewReader(data), size)
+			if err != nil {
+				continue
+			}
+
+			var end uint64
+			for i, c := range chunks {
+				if c.start < end || c.size == 0 || c.start+c.size < c.start {
+					t.Fatalf("chunk %d with start %d and size %d accepted after end %d", i, c.start, c.size, end)
+				}
+				end = c.start + c.size
+			}
+		}
+	})
+}
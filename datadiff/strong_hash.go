@@ -0,0 +1,137 @@
+package datadiff
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Strong hash identifiers stored in signatureHeader
+const (
+	hashSHA1    = uint8(1)
+	hashSHA256  = uint8(2)
+	hashBLAKE2b = uint8(3)
+
+	// hashMinSize is the smallest allowed truncated digest size
+	hashMinSize = 4
+)
+
+// strongHash is a hash algorithm that can be used for chunk hashes
+type strongHash struct {
+	id   uint8
+	name string
+	size int
+	new  func() hash.Hash
+}
+
+// strongHashes contains the supported strong hash algorithms
+var strongHashes = []strongHash{
+	{
+		id:   hashSHA1,
+		name: "sha1",
+		size: sha1.Size,
+		new:  sha1.New,
+	},
+	{
+		id:   hashSHA256,
+		name: "sha256",
+		size: sha256.Size,
+		new:  sha256.New,
+	},
+	{
+		id:   hashBLAKE2b,
+		name: "blake2b",
+		size: blake2b.Size256,
+		new: func() hash.Hash {
+			// Error is returned only for too long key
+			h, _ := blake2b.New256(nil)
+			return h
+		},
+	},
+}
+
+// strongHashNames returns names of supported strong hashes separated by comma
+func strongHashNames() string {
+	var names []string
+	for _, sh := range strongHashes {
+		names = append(names, sh.name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// hashParams selects the strong hash of chunks and the size to which its digest is truncated
+type hashParams struct {
+	id   uint8
+	size uint8
+}
+
+var defaultHashParams = hashParams{
+	id:   hashSHA1,
+	size: sha1.Size,
+}
+
+// newHashParams creates hashParams for strong hash with name. Zero size uses the full digest.
+func newHashParams(name string, size int) (hashParams, error) {
+	for _, sh := range strongHashes {
+		if sh.name == strings.ToLower(name) {
+			if size == 0 {
+				size = sh.size
+			}
+			if size < hashMinSize || size > sh.size {
+				return hashParams{}, fmt.Errorf("%s hash size has to be between %d and %d: %d",
+					sh.name, hashMinSize, sh.size, size)
+			}
+
+			return hashParams{id: sh.id, size: uint8(size)}, nil
+		}
+	}
+
+	return hashParams{}, fmt.Errorf("unknown strong hash: %s (supported: %s)", name, strongHashNames())
+}
+
+// strongHash returns the algorithm of hp or error if it is not supported
+func (hp hashParams) strongHash() (strongHash, error) {
+	for _, sh := range strongHashes {
+		if sh.id == hp.id {
+			if int(hp.size) < hashMinSize || int(hp.size) > sh.size {
+				return strongHash{}, fmt.Errorf("invalid %s hash size: %d", sh.name, hp.size)
+			}
+
+			return sh, nil
+		}
+	}
+
+	return strongHash{}, fmt.Errorf("unknown strong hash: %d", hp.id)
+}
+
+// newHasher creates chunkHasher for hp
+func (hp hashParams) newHasher() (*chunkHasher, error) {
+	sh, err := hp.strongHash()
+	if err != nil {
+		return nil, err
+	}
+
+	return &chunkHasher{
+		h:    sh.new(),
+		size: int(hp.size),
+	}, nil
+}
+
+// chunkHasher calculates truncated strong hashes of chunks
+type chunkHasher struct {
+	h    hash.Hash
+	size int
+}
+
+// sum returns the truncated strong hash of data
+func (ch *chunkHasher) sum(data []byte) []byte {
+	ch.h.Reset()
+	ch.h.Write(data)
+
+	return ch.h.Sum(nil)[:ch.size]
+}
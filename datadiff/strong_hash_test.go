@@ -0,0 +1,115 @@
+package datadiff
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHashParams(t *testing.T) {
+	var tests = []struct {
+		name        string
+		hashName    string
+		size        int
+		expected    hashParams
+		expectedErr string
+	}{
+		{
+			name:     "SHA-1 full size",
+			hashName: "sha1",
+			expected: hashParams{id: hashSHA1, size: 20},
+		},
+		{
+			name:     "SHA-256 full size",
+			hashName: "SHA256",
+			expected: hashParams{id: hashSHA256, size: 32},
+		},
+		{
+			name:     "Truncated BLAKE2b",
+			hashName: "blake2b",
+			size:     8,
+			expected: hashParams{id: hashBLAKE2b, size: 8},
+		},
+		{
+			name:        "Unknown hash",
+			hashName:    "md5",
+			expectedErr: "unknown strong hash: md5 (supported: sha1, sha256, blake2b)",
+		},
+		{
+			name:        "Too small size",
+			hashName:    "sha256",
+			size:        2,
+			expectedErr: "sha256 hash size has to be between 4 and 32: 2",
+		},
+		{
+			name:        "Larger size than digest",
+			hashName:    "sha1",
+			size:        32,
+			expectedErr: "sha1 hash size has to be between 4 and 20: 32",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hp, err := newHashParams(tt.hashName, tt.size)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "newHashParams should not return error")
+			assert.Equal(t, tt.expected, hp, "hashParams should be as expected")
+		})
+	}
+}
+
+func TestChunkHasher(t *testing.T) {
+	var tests = []struct {
+		name     string
+		params   hashParams
+		expected string
+	}{
+		{
+			name:     "SHA-1",
+			params:   hashParams{id: hashSHA1, size: 20},
+			expected: "a9993e364706816aba3e25717850c26c9cd0d89d",
+		},
+		{
+			name:     "SHA-256",
+			params:   hashParams{id: hashSHA256, size: 32},
+			expected: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+		{
+			name:     "BLAKE2b",
+			params:   hashParams{id: hashBLAKE2b, size: 32},
+			expected: "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319",
+		},
+		{
+			name:     "Truncated SHA-256",
+			params:   hashParams{id: hashSHA256, size: 8},
+			expected: "ba7816bf8f01cfea",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hasher, err := tt.params.newHasher()
+			assert.NoError(t, err, "newHasher should not return error")
+
+			// Hasher is reused for each chunk
+			for i := 0; i < 2; i++ {
+				assert.Equal(t, tt.expected, hex.EncodeToString(hasher.sum([]byte("abc"))), "Hash should be as expected")
+			}
+		})
+	}
+}
+
+func TestHashParamsErrors(t *testing.T) {
+	_, err := hashParams{id: 9, size: 20}.newHasher()
+	assert.EqualError(t, err, "unknown strong hash: 9")
+
+	_, err = hashParams{id: hashSHA1, size: 21}.newHasher()
+	assert.EqualError(t, err, "invalid sha1 hash size: 21")
+}
@@ -0,0 +1,172 @@
+package datadiff
+
+import "math"
+
+// suffixSortMaxSize is the largest data size that suffixSort accepts, as positions are stored in 32 bits
+const suffixSortMaxSize = math.MaxInt32 - 1
+
+// suffixSort returns suffix array of data. Array has len(data)+1 positions, as the empty suffix is sorted first.
+// Suffixes are sorted with SA-IS induced sorting in linear time.
+func suffixSort(data []byte) []int32 {
+	// Bytes are shifted by one, so that zero is the unique sentinel at the end
+	var text = make([]int32, len(data)+1)
+	for i, b := range data {
+		text[i] = int32(b) + 1
+	}
+
+	var sa = make([]int32, len(text))
+	sais(text, sa, 257)
+	return sa
+}
+
+// sais writes suffix array of text to sa. Text ends with sentinel zero which is smaller than the other symbols, and
+// k is the size of alphabet. Text of recursion is stored in the end of sa.
+func sais(text, sa []int32, k int) {
+	var n = len(text)
+	if n == 1 {
+		sa[0] = 0
+		return
+	}
+
+	// Suffix is S-type if it is smaller than the next suffix and L-type otherwise. LMS suffix is S-type suffix which
+	// follows L-type suffix.
+	var stype = make([]bool, n)
+	stype[n-1] = true
+	for i := n - 2; i >= 0; i-- {
+		stype[i] = text[i] < text[i+1] || text[i] == text[i+1] && stype[i+1]
+	}
+	var isLMS = func(i int32) bool {
+		return i > 0 && stype[i] && !stype[i-1]
+	}
+
+	var bkt = make([]int32, k)
+
+	// LMS substrings are sorted by inducing from LMS positions placed at the ends of their buckets
+	for i := range sa {
+		sa[i] = -1
+	}
+	saisBucketEnds(text, bkt)
+	for i := 1; i < n; i++ {
+		if isLMS(int32(i)) {
+			bkt[text[i]]--
+			sa[bkt[text[i]]] = int32(i)
+		}
+	}
+	saisInduce(text, sa, bkt, stype)
+
+	// Sorted LMS substrings are moved to the start and named by their order. Equal substrings get the same name.
+	var n1 int
+	for _, p := range sa {
+		if isLMS(p) {
+			sa[n1] = p
+			n1++
+		}
+	}
+	for i := n1; i < n; i++ {
+		sa[i] = -1
+	}
+
+	var name int32
+	var prev int32 = -1
+	for i := 0; i < n1; i++ {
+		pos := sa[i]
+		var diff bool
+		for d := int32(0); ; d++ {
+			if prev == -1 || text[pos+d] != text[prev+d] || stype[pos+d] != stype[prev+d] {
+				diff = true
+				break
+			}
+			if d > 0 && (isLMS(pos+d) || isLMS(prev+d)) {
+				break
+			}
+		}
+		if diff {
+			name++
+			prev = pos
+		}
+
+		// LMS positions are at least two apart, so names fit to the second half in position order
+		sa[int32(n1)+pos/2] = name - 1
+	}
+	for i, j := n-1, n-1; i >= n1; i-- {
+		if sa[i] >= 0 {
+			sa[j] = sa[i]
+			j--
+		}
+	}
+
+	// Order of LMS suffixes is the suffix array of the names, which is sorted recursively if names are not unique
+	var text1 = sa[n-n1:]
+	if int(name) < n1 {
+		sais(text1, sa[:n1], int(name))
+	} else {
+		for i, c := range text1 {
+			sa[c] = int32(i)
+		}
+	}
+
+	// All suffixes are induced from the sorted LMS suffixes
+	var j int
+	for i := 1; i < n; i++ {
+		if isLMS(int32(i)) {
+			text1[j] = int32(i)
+			j++
+		}
+	}
+	for i := 0; i < n1; i++ {
+		sa[i] = text1[sa[i]]
+	}
+	for i := n1; i < n; i++ {
+		sa[i] = -1
+	}
+
+	saisBucketEnds(text, bkt)
+	for i := n1 - 1; i >= 0; i-- {
+		p := sa[i]
+		sa[i] = -1
+		bkt[text[p]]--
+		sa[bkt[text[p]]] = p
+	}
+	saisInduce(text, sa, bkt, stype)
+}
+
+// saisInduce induces the order of L-type suffixes from left to right and then S-type suffixes from right to left
+func saisInduce(text, sa, bkt []int32, stype []bool) {
+	saisBucketStarts(text, bkt)
+	for i := 0; i < len(sa); i++ {
+		if j := sa[i] - 1; j >= 0 && !stype[j] {
+			sa[bkt[text[j]]] = j
+			bkt[text[j]]++
+		}
+	}
+
+	saisBucketEnds(text, bkt)
+	for i := len(sa) - 1; i >= 0; i-- {
+		if j := sa[i] - 1; j >= 0 && stype[j] {
+			bkt[text[j]]--
+			sa[bkt[text[j]]] = j
+		}
+	}
+}
+
+// saisBucketStarts sets bkt to the start of each symbol's bucket
+func saisBucketStarts(text, bkt []int32) {
+	saisBucketEnds(text, bkt)
+	for i := len(bkt) - 1; i > 0; i-- {
+		bkt[i] = bkt[i-1]
+	}
+	bkt[0] = 0
+}
+
+// saisBucketEnds sets bkt to the end of each symbol's bucket
+func saisBucketEnds(text, bkt []int32) {
+	for i := range bkt {
+		bkt[i] = 0
+	}
+	for _, c := range text {
+		bkt[c]++
+	}
+	for i := 1; i < len(bkt); i++ {
+		bkt[i] += bkt[i-1]
+	}
+}
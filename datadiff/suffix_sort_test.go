@@ -0,0 +1,60 @@
+package datadiff
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuffixSort(t *testing.T) {
+	var random = make([]byte, 5000)
+	rand.New(rand.NewSource(14)).Read(random)
+
+	var small = make([]byte, 5000)
+	for i := range small {
+		small[i] = byte(rand.Intn(3))
+	}
+
+	var tests = []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: []byte{}},
+		{name: "Single byte", data: []byte("a")},
+		{name: "Banana", data: []byte("banana")},
+		{name: "Random", data: random},
+		{name: "Small alphabet", data: small},
+		{name: "Repeated byte", data: bytes.Repeat([]byte{7}, 3000)},
+		{name: "Repeated text", data: []byte(strings.Repeat("abcab", 1000))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expected = make([]int32, len(tt.data)+1)
+			for i := range expected {
+				expected[i] = int32(i)
+			}
+			sort.Slice(expected, func(i, j int) bool {
+				return bytes.Compare(tt.data[expected[i]:], tt.data[expected[j]:]) < 0
+			})
+
+			assert.Equal(t, expected, suffixSort(tt.data), "Suffixes should be sorted")
+		})
+	}
+}
+
+func BenchmarkSuffixSort(b *testing.B) {
+	var data = make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		suffixSort(data)
+	}
+}
@@ -0,0 +1,233 @@
+package datadiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// VCDIFF (RFC 3284) delta format
+const (
+	VCDIFF_MAGIC = "\xd6\xc3\xc4\x00"
+
+	// Hdr_Indicator bits
+	VCD_DECOMPRESS = uint8(0x01)
+	VCD_CODETABLE  = uint8(0x02)
+	VCD_APPHEADER  = uint8(0x04) // xdelta3 extension
+
+	// Win_Indicator bits
+	VCD_SOURCE  = uint8(0x01)
+	VCD_TARGET  = uint8(0x02)
+	VCD_ADLER32 = uint8(0x04) // xdelta3 extension
+
+	// Instruction types
+	VCD_NOOP = uint8(0)
+	VCD_ADD  = uint8(1)
+	VCD_RUN  = uint8(2)
+	VCD_COPY = uint8(3)
+
+	// Address modes of default code table
+	VCD_SELF = uint8(0)
+	VCD_HERE = uint8(1)
+)
+
+const (
+	// Sizes of address caches of default code table
+	vcdiffNearSize = 4
+	vcdiffSameSize = 3
+
+	// vcdiffMaxWindow limits the target window size accepted from delta, as windows are decoded in memory
+	vcdiffMaxWindow = 64 * 1024 * 1024
+)
+
+// vcdiffCode is an entry of code table. Second instruction is VCD_NOOP for single instructions. Zero size is read
+// from the instruction section.
+type vcdiffCode struct {
+	inst1, size1, mode1 uint8
+	inst2, size2, mode2 uint8
+}
+
+// vcdiffCodeTable is the default code table of RFC 3284 section 5.6
+var vcdiffCodeTable = func() (t [256]vcdiffCode) {
+	var i int
+	var add = func(c vcdiffCode) {
+		t[i] = c
+		i++
+	}
+
+	add(vcdiffCode{inst1: VCD_RUN})
+
+	for size := uint8(0); size <= 17; size++ {
+		add(vcdiffCode{inst1: VCD_ADD, size1: size})
+	}
+
+	for mode := uint8(0); mode < 9; mode++ {
+		add(vcdiffCode{inst1: VCD_COPY, mode1: mode})
+		for size := uint8(4); size <= 18; size++ {
+			add(vcdiffCode{inst1: VCD_COPY, size1: size, mode1: mode})
+		}
+	}
+
+	for mode := uint8(0); mode < 6; mode++ {
+		for addSize := uint8(1); addSize <= 4; addSize++ {
+			for copySize := uint8(4); copySize <= 6; copySize++ {
+				add(vcdiffCode{inst1: VCD_ADD, size1: addSize, inst2: VCD_COPY, size2: copySize, mode2: mode})
+			}
+		}
+	}
+
+	for mode := uint8(6); mode < 9; mode++ {
+		for addSize := uint8(1); addSize <= 4; addSize++ {
+			add(vcdiffCode{inst1: VCD_ADD, size1: addSize, inst2: VCD_COPY, size2: 4, mode2: mode})
+		}
+	}
+
+	for mode := uint8(0); mode < 9; mode++ {
+		add(vcdiffCode{inst1: VCD_COPY, size1: 4, mode1: mode, inst2: VCD_ADD, size2: 1})
+	}
+
+	return
+}()
+
+// errVarint is returned for invalid or truncated integer
+var errVarint = errors.New("invalid integer")
+
+// appendVarint appends n to b as VCDIFF integer: big endian base 128 digits with high bit set in all but last digit
+func appendVarint(b []byte, n uint64) []byte {
+	var digits [10]byte
+	var i = len(digits) - 1
+
+	digits[i] = byte(n & 0x7f)
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		digits[i] = byte(n&0x7f) | 0x80
+	}
+
+	return append(b, digits[i:]...)
+}
+
+// varintLen returns the length of n as VCDIFF integer
+func varintLen(n uint64) int {
+	if n == 0 {
+		return 1
+	}
+
+	return (bits.Len64(n) + 6) / 7
+}
+
+// readVarint reads VCDIFF integer from the start of b and returns it and the remaining bytes
+func readVarint(b []byte) (uint64, []byte, error) {
+	var n uint64
+	for i, d := range b {
+		if n>>57 != 0 {
+			return 0, b, errVarint
+		}
+
+		n = n<<7 | uint64(d&0x7f)
+		if d&0x80 == 0 {
+			return n, b[i+1:], nil
+		}
+	}
+
+	return 0, b, errVarint
+}
+
+// readVarintFrom reads VCDIFF integer from r
+func readVarintFrom(r io.ByteReader) (uint64, error) {
+	var n uint64
+	for {
+		d, err := r.ReadByte()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if n>>57 != 0 {
+			return 0, errVarint
+		}
+
+		n = n<<7 | uint64(d&0x7f)
+		if d&0x80 == 0 {
+			return n, nil
+		}
+	}
+}
+
+// vcdiffAddressCache is the near and same cache of addresses with which COPY addresses are encoded
+type vcdiffAddressCache struct {
+	near     [vcdiffNearSize]uint64
+	nextSlot int
+	same     [vcdiffSameSize * 256]uint64
+}
+
+// update adds address of COPY to the cache
+func (c *vcdiffAddressCache) update(addr uint64) {
+	c.near[c.nextSlot] = addr
+	c.nextSlot = (c.nextSlot + 1) % vcdiffNearSize
+	c.same[addr%uint64(len(c.same))] = addr
+}
+
+// encode returns the mode with which addr is encoded in the fewest bytes at position here, and the value of address
+// in that mode. Value of same modes is a single byte, others are integers.
+func (c *vcdiffAddressCache) encode(addr, here uint64) (mode uint8, value uint64) {
+	mode, value = VCD_SELF, addr
+	var size = varintLen(addr)
+
+	var try = func(m uint8, v uint64, s int) {
+		if s < size {
+			mode, value, size = m, v, s
+		}
+	}
+
+	try(VCD_HERE, here-addr, varintLen(here-addr))
+	for i, near := range c.near {
+		if addr >= near {
+			try(2+uint8(i), addr-near, varintLen(addr-near))
+		}
+	}
+
+	if slot := addr % uint64(len(c.same)); c.same[slot] == addr {
+		try(2+vcdiffNearSize+uint8(slot/256), slot%256, 1)
+	}
+
+	c.update(addr)
+	return
+}
+
+// decode reads address of mode from the start of b at position here and returns it and the remaining bytes
+func (c *vcdiffAddressCache) decode(mode uint8, here uint64, b []byte) (addr uint64, rest []byte, err error) {
+	switch {
+	case mode == VCD_SELF:
+		addr, rest, err = readVarint(b)
+	case mode == VCD_HERE:
+		var d uint64
+		d, rest, err = readVarint(b)
+		if err == nil && d > here {
+			err = fmt.Errorf("address offset %d exceeds current position %d", d, here)
+		}
+		addr = here - d
+	case mode < 2+vcdiffNearSize:
+		var d uint64
+		d, rest, err = readVarint(b)
+		addr = c.near[mode-2] + d
+	case mode < 2+vcdiffNearSize+vcdiffSameSize:
+		if len(b) == 0 {
+			return 0, b, errVarint
+		}
+		addr, rest = c.same[uint64(mode-2-vcdiffNearSize)*256+uint64(b[0])], b[1:]
+	default:
+		err = fmt.Errorf("unknown address mode: %d", mode)
+	}
+	if err != nil {
+		return 0, b, err
+	}
+
+	if addr >= here {
+		return 0, b, fmt.Errorf("address %d is not before current position %d", addr, here)
+	}
+
+	c.update(addr)
+	return addr, rest, nil
+}
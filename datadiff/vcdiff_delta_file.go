@@ -0,0 +1,222 @@
+package datadiff
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	// vcdiffWindowSize is the target size of VCDIFF windows written by VcdiffDelta
+	vcdiffWindowSize = 4 * 1024 * 1024
+
+	// vcdiffMinRun is the shortest repeated byte sequence of literal data that is written as RUN instruction
+	vcdiffMinRun = 8
+)
+
+// vcdiffInstruction is an instruction of VCDIFF window
+type vcdiffInstruction struct {
+	inst uint8
+	size uint64
+
+	// addr of COPY is the address in source segment followed by target window. Writer uses basis file offsets until
+	// the window is encoded.
+	addr uint64
+
+	// data of ADD or the repeated byte of RUN. Writer keeps the data in the data section of window instead.
+	data []byte
+}
+
+// VcdiffDelta writes VCDIFF delta file to buffered writer. Commands are collected to windows of vcdiffWindowSize
+// bytes of target, which copy from the range of basis file that the COPY commands of window cover.
+type VcdiffDelta struct {
+	b *bufio.Writer
+
+	// Instructions and size of current window
+	insts      []vcdiffInstruction
+	targetSize uint64
+
+	// Basis range of current window's COPY instructions
+	hasCopy          bool
+	srcStart, srcEnd uint64
+
+	// Encoded sections of window, kept for the next window
+	data, inst, addr, window []byte
+}
+
+// NewVcdiffDelta initiates VCDIFF delta file buffer writing to w
+func NewVcdiffDelta(w io.Writer) DeltaBuffer {
+	dw := &VcdiffDelta{
+		b: bufio.NewWriter(w),
+	}
+	dw.b.WriteString(VCDIFF_MAGIC)
+
+	// Hdr_Indicator: no secondary compression or custom code table
+	dw.b.WriteByte(0)
+
+	return dw
+}
+
+// Close writes the last window and flushes the buffer. Write errors of earlier windows are returned here.
+func (dw *VcdiffDelta) Close() error {
+	dw.writeWindow()
+	return dw.b.Flush()
+}
+
+// AddLiteral writes data as ADD instructions and repeated bytes as RUN instructions
+func (dw *VcdiffDelta) AddLiteral(data []byte) {
+	for len(data) > 0 {
+		n := dw.room(uint64(len(data)))
+
+		// Data before a run is added, and run is written when it is found
+		var add int
+		for i := 0; i < n; {
+			var j = i + 1
+			for j < n && data[j] == data[i] {
+				j++
+			}
+
+			if j-i >= vcdiffMinRun {
+				dw.addInstruction(vcdiffInstruction{inst: VCD_ADD, size: uint64(i - add), data: data[add:i]})
+				dw.addInstruction(vcdiffInstruction{inst: VCD_RUN, size: uint64(j - i), data: data[i : i+1]})
+				add = j
+			}
+			i = j
+		}
+		dw.addInstruction(vcdiffInstruction{inst: VCD_ADD, size: uint64(n - add), data: data[add:n]})
+
+		data = data[n:]
+	}
+}
+
+// AddCopy writes COPY instructions of length bytes from start of basis file
+func (dw *VcdiffDelta) AddCopy(start, length uint64) {
+	for length > 0 {
+		n := uint64(dw.room(length))
+
+		// Continuous copies are combined
+		if last := len(dw.insts) - 1; last >= 0 && dw.insts[last].inst == VCD_COPY &&
+			dw.insts[last].addr+dw.insts[last].size == start {
+			dw.insts[last].size += n
+		} else {
+			dw.insts = append(dw.insts, vcdiffInstruction{inst: VCD_COPY, size: n, addr: start})
+		}
+		dw.targetSize += n
+
+		if !dw.hasCopy || start < dw.srcStart {
+			dw.srcStart = start
+		}
+		if !dw.hasCopy || start+n > dw.srcEnd {
+			dw.srcEnd = start + n
+		}
+		dw.hasCopy = true
+
+		start += n
+		length -= n
+	}
+}
+
+// room returns how many of size bytes fit to current window. Full window is written first.
+func (dw *VcdiffDelta) room(size uint64) int {
+	if dw.targetSize >= vcdiffWindowSize {
+		dw.writeWindow()
+	}
+
+	if free := vcdiffWindowSize - dw.targetSize; size > free {
+		return int(free)
+	}
+
+	return int(size)
+}
+
+// addInstruction adds ADD or RUN instruction to current window. Data of ADD and the byte of RUN are copied to the
+// data section.
+func (dw *VcdiffDelta) addInstruction(in vcdiffInstruction) {
+	if in.size == 0 {
+		return
+	}
+
+	dw.data = append(dw.data, in.data...)
+	in.data = nil
+
+	dw.insts = append(dw.insts, in)
+	dw.targetSize += in.size
+}
+
+// writeWindow encodes instructions of current window and writes the window to buffer
+func (dw *VcdiffDelta) writeWindow() {
+	if len(dw.insts) == 0 {
+		return
+	}
+
+	var srcLen uint64
+	if dw.hasCopy {
+		srcLen = dw.srcEnd - dw.srcStart
+	}
+
+	var cache vcdiffAddressCache
+	var here = srcLen
+
+	dw.inst = dw.inst[:0]
+	dw.addr = dw.addr[:0]
+	for _, in := range dw.insts {
+		switch in.inst {
+		case VCD_ADD:
+			if in.size <= 17 {
+				dw.inst = append(dw.inst, 1+uint8(in.size))
+			} else {
+				dw.inst = append(dw.inst, 1)
+				dw.inst = appendVarint(dw.inst, in.size)
+			}
+		case VCD_RUN:
+			dw.inst = append(dw.inst, 0)
+			dw.inst = appendVarint(dw.inst, in.size)
+		case VCD_COPY:
+			mode, value := cache.encode(in.addr-dw.srcStart, here)
+
+			// Copy of mode has 16 entries in code table: explicit size followed by sizes 4 to 18
+			var code = 19 + 16*mode
+			if in.size >= 4 && in.size <= 18 {
+				dw.inst = append(dw.inst, code+uint8(in.size-3))
+			} else {
+				dw.inst = append(dw.inst, code)
+				dw.inst = appendVarint(dw.inst, in.size)
+			}
+
+			if mode >= 2+vcdiffNearSize {
+				dw.addr = append(dw.addr, byte(value))
+			} else {
+				dw.addr = appendVarint(dw.addr, value)
+			}
+		}
+		here += in.size
+	}
+
+	// Delta encoding: target window size, Delta_Indicator, section lengths and sections
+	var enc = appendVarint(dw.window[:0], dw.targetSize)
+	enc = append(enc, 0)
+	enc = appendVarint(enc, uint64(len(dw.data)))
+	enc = appendVarint(enc, uint64(len(dw.inst)))
+	enc = appendVarint(enc, uint64(len(dw.addr)))
+
+	var header []byte
+	if dw.hasCopy {
+		header = append(header, VCD_SOURCE)
+		header = appendVarint(header, srcLen)
+		header = appendVarint(header, dw.srcStart)
+	} else {
+		header = append(header, 0)
+	}
+	header = appendVarint(header, uint64(len(enc)+len(dw.data)+len(dw.inst)+len(dw.addr)))
+
+	dw.b.Write(header)
+	dw.b.Write(enc)
+	dw.b.Write(dw.data)
+	dw.b.Write(dw.inst)
+	dw.b.Write(dw.addr)
+
+	dw.window = enc
+	dw.insts = dw.insts[:0]
+	dw.data = dw.data[:0]
+	dw.targetSize = 0
+	dw.hasCopy = false
+}
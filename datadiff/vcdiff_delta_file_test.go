@@ -0,0 +1,166 @@
+package datadiff
+
+import (
+	"bufio"
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVcdiffDelta(t *testing.T) {
+	var tests = []struct {
+		name     string
+		commands func(dw DeltaBuffer)
+		expected []byte
+	}{
+		{
+			name:     "Empty delta",
+			commands: func(dw DeltaBuffer) {},
+			expected: joinChunks(VCDIFF_MAGIC, "\x00"),
+		},
+		{
+			name: "Literal and copy",
+			commands: func(dw DeltaBuffer) {
+				dw.AddLiteral([]byte("hello"))
+				dw.AddCopy(10, 3)
+			},
+			expected: joinChunks(VCDIFF_MAGIC, "\x00",
+				"\x01\x03\x0a\x0e", "\x08\x00\x05\x03\x01", "hello", "\x06\x13\x03", "\x00"),
+		},
+		{
+			name: "Repeated bytes are written as run",
+			commands: func(dw DeltaBuffer) {
+				dw.AddLiteral([]byte("abzzzzzzzzzzc"))
+				dw.AddLiteral([]byte("zzzzzzz"))
+			},
+			expected: joinChunks(VCDIFF_MAGIC, "\x00",
+				"\x00\x15", "\x14\x00\x0b\x05\x00", "abzczzzzzzz", "\x03\x00\x0a\x02\x08"),
+		},
+		{
+			name: "Consecutive copies are combined",
+			commands: func(dw DeltaBuffer) {
+				dw.AddCopy(100, 4)
+				dw.AddCopy(104, 20)
+				dw.AddCopy(50, 5)
+			},
+			expected: joinChunks(VCDIFF_MAGIC, "\x00",
+				"\x01\x4a\x32\x0a", "\x1d\x00\x00\x03\x02", "\x13\x18\x15", "\x32\x00"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+
+			dw := NewVcdiffDelta(buf)
+			tt.commands(dw)
+
+			err := dw.Close()
+			assert.NoError(t, err, "Close should not return error")
+			assert.Equal(t, tt.expected, buf.Bytes(), "Delta should be as expected")
+		})
+	}
+}
+
+func TestVcdiffDeltaWindows(t *testing.T) {
+	var basis = make([]byte, 5*1024*1024)
+	rand.New(rand.NewSource(10)).Read(basis)
+
+	var literal = make([]byte, 3*1024*1024)
+	rand.New(rand.NewSource(11)).Read(literal)
+
+	delta := &bytes.Buffer{}
+	dw := NewVcdiffDelta(delta)
+	dw.AddCopy(0, uint64(len(basis)))
+	dw.AddLiteral(literal)
+	dw.AddCopy(1024*1024, 2*1024*1024)
+	assert.NoError(t, dw.Close(), "Close should not return error")
+
+	var expected = joinChunks(string(basis), string(literal), string(basis[1024*1024:3*1024*1024]))
+
+	d, err := inspectVcdiffDelta(bufio.NewReader(bytes.NewReader(delta.Bytes())))
+	assert.NoError(t, err, "inspectVcdiffDelta should not return error")
+	assert.Equal(t, 3, d.WindowCount, "New file should be split to windows of 4 MiB")
+
+	got := &bytes.Buffer{}
+	err = Patch(bytes.NewReader(basis), delta, got, PatchOptions{})
+	assert.NoError(t, err, "Patch should not return error")
+	assert.True(t, bytes.Equal(expected, got.Bytes()), "Patched data should equal to new file")
+}
+
+func TestVcdiffDeltaRandomCommands(t *testing.T) {
+	var rnd = rand.New(rand.NewSource(12))
+
+	var basis = make([]byte, 1<<16)
+	rnd.Read(basis)
+
+	// Short copies and literals exercise the address cache and all instruction codes
+	for i := 0; i < 20; i++ {
+		delta := &bytes.Buffer{}
+		dw := NewVcdiffDelta(delta)
+
+		var expected []byte
+		for n := 0; n < 500; n++ {
+			switch rnd.Intn(3) {
+			case 0:
+				start := rnd.Intn(len(basis) - 300)
+				length := 1 + rnd.Intn(300)
+				dw.AddCopy(uint64(start), uint64(length))
+				expected = append(expected, basis[start:start+length]...)
+			case 1:
+				data := make([]byte, 1+rnd.Intn(40))
+				rnd.Read(data)
+				dw.AddLiteral(data)
+				expected = append(expected, data...)
+			case 2:
+				data := bytes.Repeat([]byte{byte(rnd.Intn(256))}, 1+rnd.Intn(20))
+				dw.AddLiteral(data)
+				expected = append(expected, data...)
+			}
+		}
+		assert.NoError(t, dw.Close(), "Close should not return error")
+
+		got := &bytes.Buffer{}
+		err := Patch(bytes.NewReader(basis), delta, got, PatchOptions{})
+		assert.NoError(t, err, "Patch should not return error")
+		assert.True(t, bytes.Equal(expected, got.Bytes()), "Patched data should equal to new file")
+	}
+}
+
+func TestVcdiffFormat(t *testing.T) {
+	var basis = make([]byte, 3*chunkReadSize)
+	rand.New(rand.NewSource(13)).Read(basis)
+
+	var modified = append([]byte(nil), basis[:chunkReadSize]...)
+	modified = append(modified, bytes.Repeat([]byte{0}, 1000)...)
+	modified = append(modified, basis[2*chunkReadSize:]...)
+
+	sig := &bytes.Buffer{}
+	err := Signature(bytes.NewReader(basis), sig, SignatureOptions{})
+	assert.NoError(t, err, "Signature should not return error")
+
+	var deltas = map[string]func(out *bytes.Buffer) error{
+		"Delta": func(out *bytes.Buffer) error {
+			return Delta(bytes.NewReader(sig.Bytes()), bytes.NewReader(modified), out, DeltaOptions{Format: FormatVcdiff})
+		},
+		"Diff": func(out *bytes.Buffer) error {
+			return Diff(bytes.NewReader(basis), bytes.NewReader(modified), out, DiffOptions{Format: FormatVcdiff})
+		},
+	}
+
+	for name, create := range deltas {
+		t.Run(name, func(t *testing.T) {
+			delta := &bytes.Buffer{}
+			err := create(delta)
+			assert.NoError(t, err, "Delta should not return error")
+			assert.Equal(t, []byte(VCDIFF_MAGIC), delta.Bytes()[:4], "Delta should be in VCDIFF format")
+
+			got := &bytes.Buffer{}
+			err = Patch(bytes.NewReader(basis), delta, got, PatchOptions{})
+			assert.NoError(t, err, "Patch should not return error")
+			assert.True(t, bytes.Equal(modified, got.Bytes()), "Patched data should equal to new file")
+		})
+	}
+}
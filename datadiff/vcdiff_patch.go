@@ -0,0 +1,329 @@
+package datadiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"math"
+)
+
+// errVcdiffSectionCompression is returned for window sections with secondary compression, which xdelta3 uses by
+// default
+var errVcdiffSectionCompression = errors.New("VCDIFF secondary compression of window sections is not supported, " +
+	"create the delta without it, e.g. with xdelta3 -S none")
+
+// vcdiffWindow is a window of VCDIFF delta
+type vcdiffWindow struct {
+	// Source segment of basis file, which is followed by target window in COPY addresses
+	srcLen, srcPos uint64
+
+	targetSize uint64
+
+	// Adler-32 checksum of target window if hasChecksum is set
+	hasChecksum bool
+	checksum    uint32
+
+	data, inst, addr []byte
+}
+
+// applyVcdiffPatch reconstructs new file to out by applying VCDIFF delta to basis file. Windows are decoded in memory
+// and their checksums are verified before they are written.
+func applyVcdiffPatch(basis io.ReaderAt, r *bufio.Reader, out io.Writer, log *logger) error {
+	err := readVcdiffHeader(r)
+	if err != nil {
+		return err
+	}
+
+	var target []byte
+	for n := 0; ; n++ {
+		w, err := readVcdiffWindow(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		log.println("WINDOW", n, "Source:", w.srcPos, w.srcLen, "Target:", w.targetSize)
+
+		target, err = w.apply(basis, target[:0], log)
+		if err != nil {
+			return err
+		}
+		if w.hasChecksum && adler32.Checksum(target) != w.checksum {
+			return fmt.Errorf("%s file does not match checksum of VCDIFF window %d: %w", argNewFile, n,
+				ErrChecksumMismatch)
+		}
+
+		_, err = out.Write(target)
+		if err != nil {
+			return fmt.Errorf("failed to write %s file: %s", argNewFile, err.Error())
+		}
+	}
+}
+
+// readVcdiffHeader reads magic and header of VCDIFF delta from r. Application header is skipped.
+func readVcdiffHeader(r *bufio.Reader) error {
+	magic := make([]byte, len(VCDIFF_MAGIC))
+	_, err := io.ReadFull(r, magic)
+	if err != nil {
+		return fmt.Errorf("failed to read %s file magic: %s", argDelta, err.Error())
+	}
+	if string(magic) != VCDIFF_MAGIC {
+		return fmt.Errorf("%s file is not a VCDIFF delta", argDelta)
+	}
+
+	ind, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read VCDIFF header: %s", noEOF(err).Error())
+	}
+
+	switch {
+	case ind&VCD_DECOMPRESS != 0:
+		return fmt.Errorf("VCDIFF secondary compression (VCD_DECOMPRESS) is not supported, create the delta without " +
+			"it, e.g. with xdelta3 -S none")
+	case ind&VCD_CODETABLE != 0:
+		return fmt.Errorf("VCDIFF custom code table (VCD_CODETABLE) is not supported")
+	case ind&^VCD_APPHEADER != 0:
+		return fmt.Errorf("invalid VCDIFF header indicator: 0x%02x", ind)
+	}
+
+	if ind&VCD_APPHEADER != 0 {
+		size, err := readVarintFrom(r)
+		if err != nil {
+			return fmt.Errorf("failed to read VCDIFF application header: %s", err.Error())
+		}
+
+		_, err = io.CopyN(io.Discard, r, int64(size&math.MaxInt64))
+		if err != nil {
+			return fmt.Errorf("failed to read VCDIFF application header: %s", noEOF(err).Error())
+		}
+	}
+
+	return nil
+}
+
+// readVcdiffWindow reads the next window from r. Sections of window are read to memory. io.EOF is returned when
+// delta has no more windows.
+func readVcdiffWindow(r *bufio.Reader) (*vcdiffWindow, error) {
+	ind, err := r.ReadByte()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VCDIFF window: %s", err.Error())
+	}
+
+	switch {
+	case ind&VCD_TARGET != 0:
+		return nil, fmt.Errorf("VCDIFF window copying from earlier target data (VCD_TARGET) is not supported")
+	case ind&^(VCD_SOURCE|VCD_ADLER32) != 0:
+		return nil, fmt.Errorf("invalid VCDIFF window indicator: 0x%02x", ind)
+	}
+
+	var w = &vcdiffWindow{}
+	if ind&VCD_SOURCE != 0 {
+		w.srcLen, err = readVarintFrom(r)
+		if err == nil {
+			w.srcPos, err = readVarintFrom(r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read VCDIFF source segment: %s", err.Error())
+		}
+		if w.srcLen > math.MaxInt64 || w.srcPos > math.MaxInt64-w.srcLen {
+			return nil, fmt.Errorf("invalid VCDIFF source segment [%d, %d]", w.srcPos, w.srcLen)
+		}
+	}
+
+	size, err := readVarintFrom(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VCDIFF window length: %s", err.Error())
+	}
+	if size > vcdiffMaxWindow {
+		return nil, fmt.Errorf("VCDIFF window is too large: %d bytes", size)
+	}
+
+	enc := make([]byte, size)
+	_, err = io.ReadFull(r, enc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VCDIFF window: %s", noEOF(err).Error())
+	}
+
+	err = w.parse(enc, ind&VCD_ADLER32 != 0)
+	if err == errVcdiffSectionCompression {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid VCDIFF window: %s", err.Error())
+	}
+
+	return w, nil
+}
+
+// parse reads target window size, checksum and sections from delta encoding of window
+func (w *vcdiffWindow) parse(enc []byte, hasChecksum bool) error {
+	var err error
+	w.targetSize, enc, err = readVarint(enc)
+	if err != nil {
+		return err
+	}
+	if w.targetSize > vcdiffMaxWindow {
+		return fmt.Errorf("target window is too large: %d bytes", w.targetSize)
+	}
+
+	if len(enc) == 0 {
+		return errVarint
+	}
+	if enc[0] != 0 {
+		return errVcdiffSectionCompression
+	}
+	enc = enc[1:]
+
+	var lengths [3]uint64
+	for i := range lengths {
+		lengths[i], enc, err = readVarint(enc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasChecksum {
+		if len(enc) < 4 {
+			return fmt.Errorf("checksum is missing")
+		}
+		w.hasChecksum, w.checksum, enc = true, binary.BigEndian.Uint32(enc), enc[4:]
+	}
+
+	var sections = []*[]byte{&w.data, &w.inst, &w.addr}
+	for i, s := range sections {
+		if lengths[i] > uint64(len(enc)) {
+			return fmt.Errorf("sections exceed window length")
+		}
+		*s, enc = enc[:lengths[i]], enc[lengths[i]:]
+	}
+	if len(enc) > 0 {
+		return fmt.Errorf("%d bytes after sections", len(enc))
+	}
+
+	return nil
+}
+
+// decode calls fn for each instruction of window. Address of COPY is in the source segment followed by target
+// window, and data of ADD and RUN refers to the data section.
+func (w *vcdiffWindow) decode(fn func(in vcdiffInstruction) error) error {
+	var cache vcdiffAddressCache
+	var data, inst, addr = w.data, w.inst, w.addr
+	var pos uint64 // Position in target window
+
+	for len(inst) > 0 {
+		code := vcdiffCodeTable[inst[0]]
+		inst = inst[1:]
+
+		for _, c := range [2][3]uint8{{code.inst1, code.size1, code.mode1}, {code.inst2, code.size2, code.mode2}} {
+			if c[0] == VCD_NOOP {
+				continue
+			}
+
+			var in = vcdiffInstruction{inst: c[0], size: uint64(c[1])}
+			var err error
+			if in.size == 0 {
+				in.size, inst, err = readVarint(inst)
+				if err != nil {
+					return fmt.Errorf("invalid VCDIFF instruction size: %s", err.Error())
+				}
+			}
+			if in.size > w.targetSize-pos {
+				return fmt.Errorf("VCDIFF instructions exceed target window size %d", w.targetSize)
+			}
+
+			switch in.inst {
+			case VCD_ADD:
+				if in.size > uint64(len(data)) {
+					return fmt.Errorf("VCDIFF data section is too short")
+				}
+				in.data, data = data[:in.size], data[in.size:]
+			case VCD_RUN:
+				if len(data) == 0 {
+					return fmt.Errorf("VCDIFF data section is too short")
+				}
+				in.data, data = data[:1], data[1:]
+			case VCD_COPY:
+				in.addr, addr, err = cache.decode(c[2], w.srcLen+pos, addr)
+				if err != nil {
+					return fmt.Errorf("invalid VCDIFF COPY address: %s", err.Error())
+				}
+			}
+
+			err = fn(in)
+			if err != nil {
+				return err
+			}
+			pos += in.size
+		}
+	}
+
+	if pos != w.targetSize {
+		return fmt.Errorf("VCDIFF instructions produce %d of %d target window bytes", pos, w.targetSize)
+	}
+	if len(data) > 0 || len(addr) > 0 {
+		return fmt.Errorf("VCDIFF window has unused data or addresses")
+	}
+
+	return nil
+}
+
+// apply decodes target window of w to target which is returned
+func (w *vcdiffWindow) apply(basis io.ReaderAt, target []byte, log *logger) ([]byte, error) {
+	if uint64(cap(target)) < w.targetSize {
+		target = make([]byte, 0, w.targetSize)
+	}
+
+	err := w.decode(func(in vcdiffInstruction) error {
+		switch in.inst {
+		case VCD_ADD:
+			log.println("ADD", in.size)
+			target = append(target, in.data...)
+		case VCD_RUN:
+			log.println("RUN", in.size)
+			for i := uint64(0); i < in.size; i++ {
+				target = append(target, in.data[0])
+			}
+		case VCD_COPY:
+			log.println("COPY", in.addr, in.size)
+
+			var addr, size = in.addr, in.size
+			if addr < w.srcLen {
+				n := w.srcLen - addr
+				if n > size {
+					n = size
+				}
+
+				// Decoded instructions do not exceed target window, which fits to the capacity of target
+				start := len(target)
+				target = target[:start+int(n)]
+				read, err := basis.ReadAt(target[start:], int64(w.srcPos+addr))
+				if uint64(read) < n {
+					if err == io.EOF {
+						return fmt.Errorf("COPY command [%d, %d] exceeds %s file", w.srcPos+addr, n, argOldFile)
+					}
+					return fmt.Errorf("failed to read %s file: %s", argOldFile, err.Error())
+				}
+
+				addr += n
+				size -= n
+			}
+
+			// Rest of the copy is from target window, and it may overlap the data that it produces
+			for t := addr - w.srcLen; size > 0; t, size = t+1, size-1 {
+				target = append(target, target[t])
+			}
+		}
+
+		return nil
+	})
+
+	return target, err
+}
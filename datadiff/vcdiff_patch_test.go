@@ -0,0 +1,178 @@
+package datadiff
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// vcdiffWindowBytes returns window of VCDIFF delta. Header has Win_Indicator and source segment.
+func vcdiffWindowBytes(header string, targetSize int, checksum, data, inst, addr string) string {
+	var enc = appendVarint(nil, uint64(targetSize))
+	enc = append(enc, 0)
+	enc = appendVarint(enc, uint64(len(data)))
+	enc = appendVarint(enc, uint64(len(inst)))
+	enc = appendVarint(enc, uint64(len(addr)))
+	enc = append(enc, checksum+data+inst+addr...)
+
+	return header + string(appendVarint(nil, uint64(len(enc)))) + string(enc)
+}
+
+func TestApplyVcdiffPatch(t *testing.T) {
+	var basis = []byte("abcdefghijklmnop")
+
+	var tests = []struct {
+		name        string
+		delta       []byte
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "Empty delta",
+			delta:    joinChunks(VCDIFF_MAGIC, "\x00"),
+			expected: "",
+		},
+		{
+			name: "Example of RFC 3284 with combined instruction",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x01\x10\x00", 28, "", "wxyzz", "\x14\xac\x2c\x00\x04", "\x00\x04\x04")),
+			expected: "abcdwxyzefghefghefghefghzzzz",
+		},
+		{
+			name: "Near and same address modes",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x01\x10\x00", 12, "", "", "\x14\x34\x74", "\x08\x00\x08")),
+			expected: "ijklijklijkl",
+		},
+		{
+			name: "Copy from source segment to target window",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x01\x04\x00", 8, "", "", "\x18", "\x00")),
+			expected: "abcdabcd",
+		},
+		{
+			name: "Copy followed by add",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x01\x04\x0a", 5, "", "!", "\xf7", "\x00")),
+			expected: "klmn!",
+		},
+		{
+			name: "Several windows and application header",
+			delta: joinChunks(VCDIFF_MAGIC, "\x04", "\x03app",
+				vcdiffWindowBytes("\x00", 2, "", "xy", "\x03", ""),
+				vcdiffWindowBytes("\x01\x02\x00", 2, "", "", "\x13\x02", "\x00")),
+			expected: "xyab",
+		},
+		{
+			name: "Adler-32 checksum",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x04", 5, "\x06\x2c\x02\x15", "hello", "\x06", "")),
+			expected: "hello",
+		},
+		{
+			name: "Wrong Adler-32 checksum",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x04", 5, "\x06\x2c\x02\x16", "hello", "\x06", "")),
+			expectedErr: "NEWFILE file does not match checksum of VCDIFF window 0: checksum mismatch",
+		},
+		{
+			name:        "Wrong magic",
+			delta:       joinChunks(RS_DELTA_MAGIC, "\x00"),
+			expectedErr: "DELTA file is not a VCDIFF delta",
+		},
+		{
+			name:  "Secondary compression",
+			delta: joinChunks(VCDIFF_MAGIC, "\x01\x01"),
+			expectedErr: "VCDIFF secondary compression (VCD_DECOMPRESS) is not supported, create the delta without it, " +
+				"e.g. with xdelta3 -S none",
+		},
+		{
+			name:        "Custom code table",
+			delta:       joinChunks(VCDIFF_MAGIC, "\x02"),
+			expectedErr: "VCDIFF custom code table (VCD_CODETABLE) is not supported",
+		},
+		{
+			name:        "Target segment",
+			delta:       joinChunks(VCDIFF_MAGIC, "\x00", "\x02\x01\x00"),
+			expectedErr: "VCDIFF window copying from earlier target data (VCD_TARGET) is not supported",
+		},
+		{
+			name:  "Compressed sections",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00", "\x00\x05\x01\x01\x00\x00\x00"),
+			expectedErr: "VCDIFF secondary compression of window sections is not supported, create the delta without it, " +
+				"e.g. with xdelta3 -S none",
+		},
+		{
+			name:        "Truncated window",
+			delta:       joinChunks(VCDIFF_MAGIC, "\x00", "\x00\x05\x01"),
+			expectedErr: "failed to read VCDIFF window: unexpected EOF",
+		},
+		{
+			name: "Sections exceed window",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				"\x00\x07", "\x02\x00\x05\x01\x00", "ab"),
+			expectedErr: "invalid VCDIFF window: sections exceed window length",
+		},
+		{
+			name: "Copy outside of basis",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x01\x10\x0e", 4, "", "", "\x14", "\x00")),
+			expectedErr: "COPY command [14, 4] exceeds BASIS file",
+		},
+		{
+			name: "Address after current position",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x01\x10\x00", 4, "", "", "\x14", "\x10")),
+			expectedErr: "invalid VCDIFF COPY address: address 16 is not before current position 16",
+		},
+		{
+			name: "Instructions exceed target window",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x00", 3, "", "abcd", "\x05", "")),
+			expectedErr: "VCDIFF instructions exceed target window size 3",
+		},
+		{
+			name: "Instructions do not fill target window",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x00", 5, "", "abcd", "\x05", "")),
+			expectedErr: "VCDIFF instructions produce 4 of 5 target window bytes",
+		},
+		{
+			name: "Unused data",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x00", 1, "", "ab", "\x02", "")),
+			expectedErr: "VCDIFF window has unused data or addresses",
+		},
+		{
+			name: "Too short data section",
+			delta: joinChunks(VCDIFF_MAGIC, "\x00",
+				vcdiffWindowBytes("\x00", 8, "", "", "\x00\x08", "")),
+			expectedErr: "VCDIFF data section is too short",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &bytes.Buffer{}
+			err := applyVcdiffPatch(bytes.NewReader(basis), bufio.NewReader(bytes.NewReader(tt.delta)), got, nil)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "applyVcdiffPatch should not return error")
+			assert.Equal(t, tt.expected, got.String(), "Patched data should be as expected")
+		})
+	}
+}
+
+func TestPatchVcdiffChecksumMismatch(t *testing.T) {
+	var delta = joinChunks(VCDIFF_MAGIC, "\x00", vcdiffWindowBytes("\x04", 2, "\x00\x00\x00\x00", "hi", "\x03", ""))
+
+	err := Patch(bytes.NewReader(nil), bytes.NewReader(delta), &bytes.Buffer{}, PatchOptions{})
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "Wrong window checksum should match ErrChecksumMismatch")
+}
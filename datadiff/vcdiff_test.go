@@ -0,0 +1,108 @@
+package datadiff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVcdiffCodeTable(t *testing.T) {
+	var tests = []struct {
+		index    int
+		expected vcdiffCode
+	}{
+		{index: 0, expected: vcdiffCode{inst1: VCD_RUN}},
+		{index: 1, expected: vcdiffCode{inst1: VCD_ADD}},
+		{index: 18, expected: vcdiffCode{inst1: VCD_ADD, size1: 17}},
+		{index: 19, expected: vcdiffCode{inst1: VCD_COPY}},
+		{index: 20, expected: vcdiffCode{inst1: VCD_COPY, size1: 4}},
+		{index: 34, expected: vcdiffCode{inst1: VCD_COPY, size1: 18}},
+		{index: 35, expected: vcdiffCode{inst1: VCD_COPY, mode1: 1}},
+		{index: 162, expected: vcdiffCode{inst1: VCD_COPY, size1: 18, mode1: 8}},
+		{index: 163, expected: vcdiffCode{inst1: VCD_ADD, size1: 1, inst2: VCD_COPY, size2: 4}},
+		{index: 172, expected: vcdiffCode{inst1: VCD_ADD, size1: 4, inst2: VCD_COPY, size2: 4}},
+		{index: 234, expected: vcdiffCode{inst1: VCD_ADD, size1: 4, inst2: VCD_COPY, size2: 6, mode2: 5}},
+		{index: 235, expected: vcdiffCode{inst1: VCD_ADD, size1: 1, inst2: VCD_COPY, size2: 4, mode2: 6}},
+		{index: 246, expected: vcdiffCode{inst1: VCD_ADD, size1: 4, inst2: VCD_COPY, size2: 4, mode2: 8}},
+		{index: 247, expected: vcdiffCode{inst1: VCD_COPY, size1: 4, inst2: VCD_ADD, size2: 1}},
+		{index: 255, expected: vcdiffCode{inst1: VCD_COPY, size1: 4, mode1: 8, inst2: VCD_ADD, size2: 1}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, vcdiffCodeTable[tt.index], "Code table entry %d should be as in RFC 3284", tt.index)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	var tests = []struct {
+		n        uint64
+		expected string
+	}{
+		{n: 0, expected: "\x00"},
+		{n: 127, expected: "\x7f"},
+		{n: 128, expected: "\x81\x00"},
+		{n: 123456789, expected: "\xba\xef\x9a\x15"},
+		{n: 1<<64 - 1, expected: "\x81\xff\xff\xff\xff\xff\xff\xff\xff\x7f"},
+	}
+
+	for _, tt := range tests {
+		b := appendVarint(nil, tt.n)
+		assert.Equal(t, []byte(tt.expected), b, "Integer %d should be encoded as expected", tt.n)
+		assert.Equal(t, len(b), varintLen(tt.n), "Length of %d should be as encoded", tt.n)
+
+		n, rest, err := readVarint(append(b, 'x'))
+		assert.NoError(t, err, "readVarint should not return error")
+		assert.Equal(t, tt.n, n, "Integer should be decoded")
+		assert.Equal(t, []byte("x"), rest, "Remaining bytes should follow the integer")
+	}
+
+	for _, b := range []string{"", "\x81", "\x82\xff\xff\xff\xff\xff\xff\xff\xff\x7f"} {
+		_, _, err := readVarint([]byte(b))
+		assert.Equal(t, errVarint, err, "Truncated or too large integer should be invalid")
+	}
+}
+
+func TestVcdiffAddressCache(t *testing.T) {
+	// Near cache is filled with later addresses before the first address is found from same cache
+	var tests = []struct {
+		addr, here    uint64
+		expectedMode  uint8
+		expectedValue uint64
+	}{
+		{addr: 100000, here: 300000, expectedMode: VCD_SELF, expectedValue: 100000},
+		{addr: 200000, here: 300000, expectedMode: VCD_SELF, expectedValue: 200000},
+		{addr: 201000, here: 300000, expectedMode: 3, expectedValue: 1000},
+		{addr: 202000, here: 300000, expectedMode: 3, expectedValue: 2000},
+		{addr: 203000, here: 300000, expectedMode: 3, expectedValue: 3000},
+		{addr: 100000, here: 300000, expectedMode: 6, expectedValue: 100000 % 768},
+		{addr: 299990, here: 300000, expectedMode: VCD_HERE, expectedValue: 10},
+		{addr: 299990, here: 300200, expectedMode: 4, expectedValue: 0},
+	}
+
+	var encoder, decoder vcdiffAddressCache
+	for _, tt := range tests {
+		mode, value := encoder.encode(tt.addr, tt.here)
+		assert.Equal(t, tt.expectedMode, mode, "Address %d should be encoded in expected mode", tt.addr)
+		assert.Equal(t, tt.expectedValue, value, "Address %d should be encoded as expected value", tt.addr)
+
+		var b []byte
+		if mode >= 2+vcdiffNearSize {
+			b = []byte{byte(value)}
+		} else {
+			b = appendVarint(nil, value)
+		}
+
+		addr, rest, err := decoder.decode(mode, tt.here, b)
+		assert.NoError(t, err, "decode should not return error")
+		assert.Equal(t, tt.addr, addr, "Address should be decoded")
+		assert.Empty(t, rest, "Whole address should be read")
+	}
+
+	var c vcdiffAddressCache
+	_, _, err := c.decode(VCD_SELF, 10, []byte{10})
+	assert.EqualError(t, err, "address 10 is not before current position 10")
+	_, _, err = c.decode(VCD_HERE, 10, []byte{11})
+	assert.EqualError(t, err, "address offset 11 exceeds current position 10")
+	_, _, err = c.decode(9, 10, []byte{0})
+	assert.EqualError(t, err, "unknown address mode: 9")
+}
@@ -1,15 +1,160 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
 )
 
-// writeFile writes to file pointed by argFile2 global variable
-func writeFile(data []byte) error {
-	return ioutil.WriteFile(argOutputFile, data, os.ModePerm)
+// linkFile creates hard link, replaceable in tests of filesystems without hard links
+var linkFile = os.Link
+
+// syncDir syncs directory entries of dir, replaceable in tests
+var syncDir = syncDirectory
+
+// outputFile is written to a temporary file in the directory of the output file. The temporary file replaces the
+// output file only when it is committed, so readers never see partial output.
+type outputFile struct {
+	*os.File
+
+	// Output file name and its argument name, empty name is stdout
+	arg  string
+	name string
+
+	// force allows replacing existing output file
+	force bool
+}
+
+// createFile creates temporary file for output file pointed by name with permissions perm. Empty name refers to
+// stdout which is written directly.
+func createFile(arg, name string, perm os.FileMode, force bool) (*outputFile, error) {
+	if name == "" {
+		return &outputFile{File: os.Stdout}, nil
+	}
+
+	dir, base := filepath.Split(name)
+	if dir == "" {
+		dir = "."
+	}
+
+	file, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return nil, err
+	}
+
+	err = file.Chmod(perm)
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	return &outputFile{
+		File:  file,
+		arg:   arg,
+		name:  name,
+		force: force,
+	}, nil
+}
+
+// commit syncs and closes the temporary file and moves it in place of the output file. Existing output file is
+// replaced only with force, which is checked again as the file may have been created meanwhile. Filesystems without
+// hard links fall back to an exclusive create before the rename. The directory is synced last so that the new name
+// survives a crash.
+func (f *outputFile) commit() error {
+	if f.name == "" {
+		return nil
+	}
+
+	err := f.Sync()
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+
+	if f.force {
+		err = os.Rename(f.File.Name(), f.name)
+	} else {
+		// Link fails if output file exists, unlike rename which would replace it
+		err = linkFile(f.File.Name(), f.name)
+		if err == nil {
+			err = os.Remove(f.File.Name())
+		} else if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOTSUP) {
+			err = f.reserveAndRename()
+		}
+		if os.IsExist(err) {
+			err = fmt.Errorf("%s file already exists: %s", f.arg, f.name)
+		}
+	}
+	if err != nil {
+		os.Remove(f.File.Name())
+		return err
+	}
+
+	return syncDir(filepath.Dir(f.name))
+}
+
+// syncDirectory syncs directory entries of dir. Systems that cannot sync directories are not treated as errors.
+func syncDirectory(dir string) error {
+	// Directories cannot be opened for writing on Windows, which commits renames without sync
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = d.Sync()
+	d.Close()
+	if err != nil && !dirSyncUnsupported(err) {
+		return fmt.Errorf("failed to sync directory %s: %s", dir, err.Error())
+	}
+
+	return nil
+}
+
+// dirSyncUnsupported tells whether err of directory sync means that the filesystem does not support it
+func dirSyncUnsupported(err error) bool {
+	return errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP)
+}
+
+// reserveAndRename moves the temporary file in place of the output file on filesystems without hard links. The output
+// file is created exclusively first, so an existing file is not replaced unless it is created between the create and
+// the rename.
+func (f *outputFile) reserveAndRename() error {
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	err = os.Rename(f.File.Name(), f.name)
+	if err != nil {
+		os.Remove(f.name)
+		return err
+	}
+
+	return nil
+}
+
+// abort closes and removes the temporary file leaving output file untouched
+func (f *outputFile) abort() {
+	if f.name == "" {
+		return
+	}
+
+	f.Close()
+	os.Remove(f.File.Name())
 }
 
 // openReadFile opens file poinsted by name.
@@ -47,10 +192,5 @@ func checkFileDoesNotExist(arg, name string) error {
 		return err
 	}
 	file.Close()
-	return fmt.Errorf("%s file file already exists: %s", arg, name)
-}
-
-// readFile reads a files content and returns error if it is a directory
-func readFile(r io.Reader) ([]byte, error) {
-	return io.ReadAll(r)
+	return fmt.Errorf("%s file already exists: %s", arg, name)
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeOutput writes data to output file name and commits it
+func writeOutput(name string, data string, perm os.FileMode, force bool) error {
+	f, err := createFile(ArgSignature, name, perm, force)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(data)
+	if err != nil {
+		f.abort()
+		return err
+	}
+
+	return f.commit()
+}
+
+// dirFiles returns names of files in dir
+func dirFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err, "ReadDir should not return error")
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names
+}
+
+func TestOutputFile(t *testing.T) {
+	var tests = []struct {
+		name         string
+		existing     string
+		perm         os.FileMode
+		force        bool
+		noLinks      bool
+		expected     string
+		expectedPerm os.FileMode
+		expectedErr  string
+	}{
+		{
+			name:         "New file",
+			perm:         0644,
+			expected:     "output",
+			expectedPerm: 0644,
+		},
+		{
+			name:         "Private file",
+			perm:         0600,
+			expected:     "output",
+			expectedPerm: 0600,
+		},
+		{
+			name:         "Existing file is replaced with force",
+			existing:     "existing",
+			perm:         0644,
+			force:        true,
+			expected:     "output",
+			expectedPerm: 0644,
+		},
+		{
+			name:         "Existing file is kept without force",
+			existing:     "existing",
+			perm:         0600,
+			expected:     "existing",
+			expectedPerm: 0644,
+			expectedErr:  "SIGNATURE file already exists: ",
+		},
+		{
+			name:         "New file without hard links",
+			perm:         0600,
+			noLinks:      true,
+			expected:     "output",
+			expectedPerm: 0600,
+		},
+		{
+			name:         "Existing file is kept without hard links",
+			existing:     "existing",
+			perm:         0600,
+			noLinks:      true,
+			expected:     "existing",
+			expectedPerm: 0644,
+			expectedErr:  "SIGNATURE file already exists: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dir = t.TempDir()
+			var name = filepath.Join(dir, "signature")
+
+			if tt.existing != "" {
+				err := os.WriteFile(name, []byte(tt.existing), 0644)
+				assert.NoError(t, err, "WriteFile should not return error")
+				assert.NoError(t, os.Chmod(name, 0644), "Chmod should not return error")
+			}
+
+			var synced []string
+			syncDir = func(dir string) error {
+				synced = append(synced, dir)
+				return syncDirectory(dir)
+			}
+			defer func() { syncDir = syncDirectory }()
+
+			if tt.noLinks {
+				linkFile = func(oldname, newname string) error {
+					return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.ENOTSUP}
+				}
+				defer func() { linkFile = os.Link }()
+			}
+
+			err := writeOutput(name, "output", tt.perm, tt.force)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr+name)
+			} else {
+				assert.NoError(t, err, "Output should be committed")
+				assert.Equal(t, []string{dir}, synced, "Directory should be synced after commit")
+			}
+
+			data, err := os.ReadFile(name)
+			assert.NoError(t, err, "ReadFile should not return error")
+			assert.Equal(t, tt.expected, string(data), "Output file should have expected content")
+
+			stat, err := os.Stat(name)
+			assert.NoError(t, err, "Stat should not return error")
+			assert.Equal(t, tt.expectedPerm, stat.Mode().Perm(), "Output file should have expected permissions")
+
+			assert.Equal(t, []string{"signature"}, dirFiles(t, dir), "Temporary file should not be left behind")
+		})
+	}
+}
+
+func TestOutputFileAbort(t *testing.T) {
+	var dir = t.TempDir()
+	var name = filepath.Join(dir, "signature")
+
+	f, err := createFile(ArgSignature, name, 0644, false)
+	assert.NoError(t, err, "createFile should not return error")
+
+	_, err = f.WriteString("partial")
+	assert.NoError(t, err, "WriteString should not return error")
+	assert.NoFileExists(t, name, "Output file should not exist before commit")
+
+	f.abort()
+	assert.Empty(t, dirFiles(t, dir), "Aborted output should leave no files")
+}
+
+func TestSyncDirectory(t *testing.T) {
+	assert.NoError(t, syncDirectory(t.TempDir()), "syncDirectory should not return error")
+	assert.Error(t, syncDirectory(filepath.Join(t.TempDir(), "missing")), "Missing directory should not be synced")
+
+	assert.True(t, dirSyncUnsupported(&os.PathError{Op: "sync", Path: ".", Err: syscall.EINVAL}),
+		"EINVAL should mean unsupported sync")
+	assert.True(t, dirSyncUnsupported(syscall.ENOTSUP), "ENOTSUP should mean unsupported sync")
+	assert.False(t, dirSyncUnsupported(syscall.EIO), "EIO should fail sync")
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := parseMode("0640")
+	assert.NoError(t, err, "parseMode should not return error")
+	assert.Equal(t, os.FileMode(0640), mode, "Mode should be parsed as octal")
+
+	_, err = parseMode("0800")
+	assert.EqualError(t, err, "invalid mode: 0800")
+
+	_, err = parseMode("1777")
+	assert.EqualError(t, err, "invalid mode: 1777")
+}
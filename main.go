@@ -1,45 +1,237 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"math"
 	"os"
+	"strconv"
 	"strings"
-)
-
-var (
-	argMode       string
-	argOutputFile string
+	"unicode"
 
-	Verbose       = false
-	ForceOverride = false
+	"data-diff/datadiff"
 )
 
 const (
 	ModeSignature = "signature"
 	ModeDelta     = "delta"
+	ModePatch     = "patch"
+	ModeDiff      = "diff"
+	ModeInspect   = "inspect"
 
 	ArgSignature = "SIGNATURE"
 	ArgDelta     = "DELTA"
 	ArgNewFile   = "NEWFILE"
 	ArgOldFile   = "BASIS"
+	ArgFile      = "FILE"
+
+	// stdStreamArg in place of file argument refers to stdin or stdout
+	stdStreamArg = "-"
 
 	usageText = `
 Usage: data-diff [OPTIONS] signature [BASIS [SIGNATURE]]
                  [OPTIONS] delta SIGNATURE [NEWFILE [DELTA]]
+                 [OPTIONS] patch BASIS DELTA [NEWFILE]
+                 [OPTIONS] diff BASIS NEWFILE [DELTA]
+                 [OPTIONS] inspect [FILE]
 
 Options:
 -v, --verbose             Trace internal processing
 -?, --help                Show this help message
--f, --force               Force overwriting existing files`
+-f, --force               Force overwriting existing files
+    --byte-match          Search signature chunks at every byte offset of NEWFILE
+    --json                Write inspect output as JSON
+    --min-chunk=BYTES     Minimum chunk size of signature (default 32)
+    --max-chunk=BYTES     Maximum chunk size of signature (default 1024)
+    --avg-chunk=BYTES     Average chunk size of signature, power of two (default 128)
+    --chunker=NAME        Chunking algorithm of signature: polynomial, fastcdc, rabin,
+                          buzhash or casync (default polynomial)
+    --rabin-poly=POLY     Irreducible polynomial of rabin chunker, hexadecimal with 0x
+                          prefix (default 0x3DA3358B4DC173)
+    --buzhash-seed=N      XOR buzhash table with 32 bit seed N (default 0)
+    --buzhash-table=FILE  Read 256 32 bit values of buzhash table from FILE, separated by
+                          whitespace or commas (default fixed random table)
+    --hash=ALG            Strong hash of signature: sha1, sha256 or blake2b (default sha1),
+                          md4 or blake2b with rdiff format (default blake2b)
+    --hash-size=BYTES     Truncate strong hash to BYTES (default full hash)
+    --format=FORMAT       Format of signature or delta: data-diff or rdiff, or vcdiff or
+                          bsdiff for delta (default data-diff, delta of rdiff signature
+                          defaults to rdiff)
+    --block-size=BYTES    Block size of rdiff signature (default 2048)
+    --min-match=BYTES     Minimum length of data copied from BASIS by diff (default 16)
+-j, --jobs=N              Calculate strong hashes of chunks in N goroutines (default 1)
+    --mode=MODE           Octal permissions of created file (default 0644)
+
+Missing optional file arguments and "-" refer to stdin or stdout. Verbose
+output is written to stderr. Output file is written to a temporary file
+which replaces the output file only after all data is written.
+
+Sizes accept K, M and G suffixes. Delta uses the chunk sizes and strong hash
+stored in SIGNATURE and detects rdiff signatures by their magic.
 
-	noArgumentsText = "You must specify an action: `signature' or `delta'." +
+Data-diff signatures and deltas end with checksums of whole files. Patch
+verifies BASIS and NEWFILE against the checksums of DELTA and fails if they
+do not match. Patch also applies VCDIFF and BSDIFF40 deltas, which are
+detected by their magic. VCDIFF deltas must not use secondary compression,
+custom code tables or target windows (VCD_TARGET), e.g. xdelta3 needs -S none.
+
+Diff creates DELTA from BASIS and NEWFILE without a signature. Both files are
+read to memory and data of BASIS is copied wherever it is found in NEWFILE,
+so the delta is usually smaller than the delta of a signature. Diff with
+--format=bsdiff writes differences of approximate matches like bsdiff, which
+suits executables.
+
+Inspect detects whether FILE is a signature or a delta and describes it: the
+header, chunk size distribution and every chunk of signatures, and every
+COPY and LITERAL command of deltas.`
+
+	noArgumentsText = "You must specify an action: `signature', `delta', `patch', `diff' or `inspect'." +
 		"\nTry `data-diff --help' for more information."
 )
 
-// processFileArg checks file arguments details
-func processFileArg(args []string, idx int, argName string, read bool) (readFile *os.File, err error) {
-	if len(args) <= idx {
-		return nil, fmt.Errorf("argument \"%s\" is missing", argName)
+// cliOptions holds the parsed command line options. Zero values select defaults of datadiff.
+type cliOptions struct {
+	verbose      bool
+	force        bool
+	jobs         int
+	mode         string
+	rabinPoly    string
+	buzhashSeed  string
+	buzhashTable string
+
+	signature datadiff.SignatureOptions
+	delta     datadiff.DeltaOptions
+	patch     datadiff.PatchOptions
+	diff      datadiff.DiffOptions
+	inspect   datadiff.InspectOptions
+}
+
+// validate checks that options of mode are supported
+func (o *cliOptions) validate(mode string) error {
+	switch mode {
+	case ModeSignature:
+		return o.signature.Validate()
+	case ModeDelta:
+		return o.delta.Validate()
+	case ModeDiff:
+		return o.diff.Validate()
+	}
+
+	return nil
+}
+
+// sizeOptions maps options that take size or count value to their fields in o
+func (o *cliOptions) sizeOptions() map[string]*int {
+	return map[string]*int{
+		"--min-chunk":  &o.signature.MinChunk,
+		"--max-chunk":  &o.signature.MaxChunk,
+		"--avg-chunk":  &o.signature.AvgChunk,
+		"--hash-size":  &o.signature.HashSize,
+		"--block-size": &o.signature.BlockSize,
+		"--min-match":  &o.diff.MinMatch,
+		"--jobs":       &o.jobs,
+		"-j":           &o.jobs,
+	}
+}
+
+// stringOptions maps options that take string value to their fields in o
+func (o *cliOptions) stringOptions() map[string]*string {
+	return map[string]*string{
+		"--hash":          &o.signature.Hash,
+		"--format":        &o.signature.Format,
+		"--chunker":       &o.signature.Chunker,
+		"--rabin-poly":    &o.rabinPoly,
+		"--buzhash-seed":  &o.buzhashSeed,
+		"--buzhash-table": &o.buzhashTable,
+		"--mode":          &o.mode,
+	}
+}
+
+// command is the mode and files of the command line arguments
+type command struct {
+	mode string
+
+	// Input files in the order of arguments
+	file0 *os.File
+	file1 *os.File
+
+	// outputFile is empty for stdout
+	outputFile string
+	outputArg  string
+}
+
+// parseSize parses size in bytes with optional K, M or G suffix
+func parseSize(value string) (int, error) {
+	var multiplier = 1
+	var number = value
+
+	if len(value) > 0 {
+		switch value[len(value)-1] {
+		case 'k', 'K':
+			multiplier = 1024
+		case 'm', 'M':
+			multiplier = 1024 * 1024
+		case 'g', 'G':
+			multiplier = 1024 * 1024 * 1024
+		}
+	}
+	if multiplier > 1 {
+		number = value[:len(value)-1]
+	}
+
+	size, err := strconv.Atoi(number)
+	if err != nil || size < 0 || size > math.MaxInt32/multiplier {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+
+	return size * multiplier, nil
+}
+
+// parseUint parses unsigned integer of bitSize bits. Prefix 0x selects hexadecimal.
+func parseUint(value string, bitSize int) (uint64, error) {
+	n, err := strconv.ParseUint(value, 0, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %s", value)
+	}
+
+	return n, nil
+}
+
+// parseBuzhashTable parses 32 bit values of buzhash table separated by whitespace or commas
+func parseBuzhashTable(value string) ([]uint32, error) {
+	var fields = strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	var table = make([]uint32, 0, len(fields))
+	for _, f := range fields {
+		n, err := parseUint(f, 32)
+		if err != nil {
+			return nil, err
+		}
+		table = append(table, uint32(n))
+	}
+
+	return table, nil
+}
+
+// parseMode parses octal file permissions
+func parseMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > uint64(os.ModePerm) {
+		return 0, fmt.Errorf("invalid mode: %s", value)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// processFileArg checks file arguments details. Missing optional argument and "-" refer to stdin or stdout.
+func processFileArg(args []string, idx int, argName string, read, force bool) (readFile *os.File, err error) {
+	if len(args) <= idx || args[idx] == stdStreamArg {
+		if read {
+			readFile = os.Stdin
+		}
+		return
 	}
 
 	if read {
@@ -47,7 +239,7 @@ func processFileArg(args []string, idx int, argName string, read bool) (readFile
 		if err != nil {
 			return nil, err
 		}
-	} else if !ForceOverride {
+	} else if !force {
 		err = checkFileDoesNotExist(argName, args[idx])
 		if err != nil {
 			return nil, err
@@ -57,59 +249,135 @@ func processFileArg(args []string, idx int, argName string, read bool) (readFile
 	return
 }
 
-// processArguments processes passed arguments and returns opened files handlers if it succeeds
-// otherwise an error is returned.
-func processArguments(args []string) (file0, file1 *os.File, err error) {
+// outputFileArg returns the name of output file argument or empty name for stdout
+func outputFileArg(args []string, idx int) string {
+	if len(args) <= idx || args[idx] == stdStreamArg {
+		return ""
+	}
+
+	return args[idx]
+}
+
+// processArguments processes passed arguments and returns the command with opened files handlers if it succeeds
+// otherwise an error is returned. With force existing output file can be overwritten.
+func processArguments(args []string, force bool) (cmd command, err error) {
 	if len(args) > 0 {
 		switch strings.ToLower(args[0]) {
 		case ModeSignature:
-			argMode = ModeSignature
+			cmd.mode = ModeSignature
 		case ModeDelta:
-			argMode = ModeDelta
+			cmd.mode = ModeDelta
+		case ModePatch:
+			cmd.mode = ModePatch
+		case ModeDiff:
+			cmd.mode = ModeDiff
+		case ModeInspect:
+			cmd.mode = ModeInspect
 		default:
-			return nil, nil, fmt.Errorf("unsupported mode: %s", os.Args[1])
+			return cmd, fmt.Errorf("unsupported mode: %s", args[0])
 		}
 	} else {
-		return nil, nil, fmt.Errorf("first argument is missing")
+		return cmd, fmt.Errorf("first argument is missing")
 	}
 
 	defer func() {
-		if err != nil && file0 != nil {
-			file0.Close()
+		if err != nil && cmd.file0 != nil {
+			cmd.file0.Close()
 		}
-		if err != nil && file1 != nil {
-			file1.Close()
+		if err != nil && cmd.file1 != nil {
+			cmd.file1.Close()
 		}
 	}()
 
-	switch argMode {
+	switch cmd.mode {
 	case ModeSignature:
-		file0, err = processFileArg(args, 1, ArgOldFile, true)
+		cmd.file0, err = processFileArg(args, 1, ArgOldFile, true, force)
 		if err != nil {
 			return
 		}
 
-		_, err = processFileArg(args, 2, ArgSignature, false)
+		_, err = processFileArg(args, 2, ArgSignature, false, force)
 		if err != nil {
 			return
 		}
-		argOutputFile = args[2]
+		cmd.outputFile, cmd.outputArg = outputFileArg(args, 2), ArgSignature
 	case ModeDelta:
-		file0, err = processFileArg(args, 1, ArgSignature, true)
+		if len(args) < 2 {
+			return cmd, fmt.Errorf("argument \"%s\" is missing", ArgSignature)
+		}
+
+		cmd.file0, err = processFileArg(args, 1, ArgSignature, true, force)
 		if err != nil {
 			return
 		}
 
-		file1, err = processFileArg(args, 2, ArgNewFile, true)
+		cmd.file1, err = processFileArg(args, 2, ArgNewFile, true, force)
 		if err != nil {
 			return
 		}
+		if cmd.file0 == os.Stdin && cmd.file1 == os.Stdin {
+			err = fmt.Errorf("%s and %s can not both be read from stdin", ArgSignature, ArgNewFile)
+			return
+		}
 
-		_, err = processFileArg(args, 3, ArgDelta, false)
+		_, err = processFileArg(args, 3, ArgDelta, false, force)
+		if err != nil {
+			return
+		}
+		cmd.outputFile, cmd.outputArg = outputFileArg(args, 3), ArgDelta
+	case ModePatch:
+		if len(args) < 3 {
+			return cmd, fmt.Errorf("argument \"%s\" is missing", []string{ArgOldFile, ArgDelta}[len(args)-1])
+		}
+		if args[1] == stdStreamArg {
+			// Copy commands read basis file at random offsets
+			return cmd, fmt.Errorf("%s can not be read from stdin", ArgOldFile)
+		}
+
+		cmd.file0, err = processFileArg(args, 1, ArgOldFile, true, force)
+		if err != nil {
+			return
+		}
+
+		cmd.file1, err = processFileArg(args, 2, ArgDelta, true, force)
+		if err != nil {
+			return
+		}
+
+		_, err = processFileArg(args, 3, ArgNewFile, false, force)
+		if err != nil {
+			return
+		}
+		cmd.outputFile, cmd.outputArg = outputFileArg(args, 3), ArgNewFile
+	case ModeDiff:
+		if len(args) < 3 {
+			return cmd, fmt.Errorf("argument \"%s\" is missing", []string{ArgOldFile, ArgNewFile}[len(args)-1])
+		}
+
+		cmd.file0, err = processFileArg(args, 1, ArgOldFile, true, force)
+		if err != nil {
+			return
+		}
+
+		cmd.file1, err = processFileArg(args, 2, ArgNewFile, true, force)
+		if err != nil {
+			return
+		}
+		if cmd.file0 == os.Stdin && cmd.file1 == os.Stdin {
+			err = fmt.Errorf("%s and %s can not both be read from stdin", ArgOldFile, ArgNewFile)
+			return
+		}
+
+		_, err = processFileArg(args, 3, ArgDelta, false, force)
+		if err != nil {
+			return
+		}
+		cmd.outputFile, cmd.outputArg = outputFileArg(args, 3), ArgDelta
+	case ModeInspect:
+		cmd.file0, err = processFileArg(args, 1, ArgFile, true, force)
 		if err != nil {
 			return
 		}
-		argOutputFile = args[3]
 	}
 
 	return
@@ -126,18 +394,59 @@ func main() {
 		os.Exit(1)
 	}
 
+	var opts = cliOptions{mode: "0644"}
+	var sizeOptions = opts.sizeOptions()
+	var stringOptions = opts.stringOptions()
+
 	var args []string
-	for _, arg := range os.Args[1:] {
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
 		switch arg {
 		case "-?", "--help":
 			fmt.Println(usageText)
 			os.Exit(0)
 		case "-v", "--verbose":
-			Verbose = true
+			opts.verbose = true
 		case "-f", "--force":
-			ForceOverride = true
+			opts.force = true
+		case "--byte-match":
+			opts.delta.ByteMatch = true
+		case "--json":
+			opts.inspect.JSON = true
 		default:
-			if len(arg) > 0 && arg[0] == '-' {
+			name, value := arg, ""
+			if j := strings.IndexByte(arg, '='); j > 0 {
+				name, value = arg[:j], arg[j+1:]
+			}
+
+			size, isSize := sizeOptions[name]
+			str, isString := stringOptions[name]
+			if isSize || isString {
+				if name == arg {
+					// Value is given as next argument
+					i++
+					if i == len(os.Args) {
+						stdErr("data-diff: option requires a value:", arg)
+						os.Exit(2)
+					}
+					value = os.Args[i]
+				}
+
+				if isString {
+					*str = value
+					continue
+				}
+
+				var err error
+				*size, err = parseSize(value)
+				if err != nil {
+					stdErr("data-diff: option "+name+":", err.Error())
+					os.Exit(2)
+				}
+				continue
+			}
+
+			if len(arg) > 1 && arg[0] == '-' {
 				stdErr("data-diff: unknown option:", arg)
 				os.Exit(2)
 			}
@@ -145,32 +454,108 @@ func main() {
 		}
 	}
 
-	file0, file1, err := processArguments(args)
+	mode, err := parseMode(opts.mode)
+	if err != nil {
+		stdErr("data-diff: option --mode:", err.Error())
+		os.Exit(2)
+	}
+
+	if opts.rabinPoly != "" {
+		opts.signature.RabinPolynomial, err = parseUint(opts.rabinPoly, 64)
+		if err != nil {
+			stdErr("data-diff: option --rabin-poly:", err.Error())
+			os.Exit(2)
+		}
+	}
+
+	if opts.buzhashSeed != "" {
+		seed, err := parseUint(opts.buzhashSeed, 32)
+		if err != nil {
+			stdErr("data-diff: option --buzhash-seed:", err.Error())
+			os.Exit(2)
+		}
+		opts.signature.BuzhashSeed = uint32(seed)
+	}
+
+	if opts.buzhashTable != "" {
+		data, err := os.ReadFile(opts.buzhashTable)
+		if err == nil {
+			opts.signature.BuzhashTable, err = parseBuzhashTable(string(data))
+		}
+		if err != nil {
+			stdErr("data-diff: option --buzhash-table:", err.Error())
+			os.Exit(2)
+		}
+	}
+
+	opts.signature.Jobs = opts.jobs
+	opts.delta.Jobs = opts.jobs
+	opts.delta.Format = opts.signature.Format
+	opts.diff.Format = opts.signature.Format
+
+	if opts.verbose {
+		opts.signature.Log = os.Stderr
+		opts.delta.Log = os.Stderr
+		opts.patch.Log = os.Stderr
+		opts.diff.Log = os.Stderr
+	}
+
+	cmd, err := processArguments(args, opts.force)
+	if err == nil {
+		err = opts.validate(cmd.mode)
+	}
 	if err != nil {
 		stdErr("data-diff:", err.Error())
 		os.Exit(2)
 	}
 
+	output, err := createFile(cmd.outputArg, cmd.outputFile, mode, opts.force)
+	if err != nil {
+		stdErr("data-diff:", err.Error())
+		os.Exit(4)
+	}
+
 	// Run in specified mode
-	var output []byte
-	switch argMode {
+	out := bufio.NewWriter(output)
+	switch cmd.mode {
 	case ModeSignature:
-		output, err = createSignature(file0)
+		err = datadiff.Signature(cmd.file0, out, opts.signature)
 
-		file0.Close()
+		cmd.file0.Close()
 	case ModeDelta:
-		output, err = createDelta(file0, file1)
+		err = datadiff.Delta(cmd.file0, cmd.file1, out, opts.delta)
+
+		cmd.file0.Close()
+		cmd.file1.Close()
+	case ModePatch:
+		err = datadiff.Patch(cmd.file0, cmd.file1, out, opts.patch)
+
+		cmd.file0.Close()
+		cmd.file1.Close()
+	case ModeDiff:
+		err = datadiff.Diff(cmd.file0, cmd.file1, out, opts.diff)
 
-		file0.Close()
-		file1.Close()
+		cmd.file0.Close()
+		cmd.file1.Close()
+	case ModeInspect:
+		err = datadiff.Inspect(cmd.file0, out, opts.inspect)
+
+		cmd.file0.Close()
+	}
+
+	if err == nil {
+		err = out.Flush()
 	}
 
 	if err != nil {
+		// Do not leave partial output behind
+		output.abort()
+
 		stdErr("data-diff:", err.Error())
 		os.Exit(3)
 	}
 
-	err = writeFile(output)
+	err = output.commit()
 	if err != nil {
 		stdErr("data-diff:", err.Error())
 		os.Exit(4)
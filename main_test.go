@@ -0,0 +1,227 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	var tests = []struct {
+		value       string
+		expected    int
+		expectedErr string
+	}{
+		{value: "32", expected: 32},
+		{value: "4k", expected: 4096},
+		{value: "4K", expected: 4096},
+		{value: "1M", expected: 1024 * 1024},
+		{value: "1g", expected: 1024 * 1024 * 1024},
+		{value: "", expectedErr: "invalid size: "},
+		{value: "K", expectedErr: "invalid size: K"},
+		{value: "-1", expectedErr: "invalid size: -1"},
+		{value: "1.5M", expectedErr: "invalid size: 1.5M"},
+		{value: "8G", expectedErr: "invalid size: 8G"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			size, err := parseSize(tt.value)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "parseSize should not return error")
+			assert.Equal(t, tt.expected, size, "Size should be as expected")
+		})
+	}
+}
+
+func TestParseUint(t *testing.T) {
+	var tests = []struct {
+		value       string
+		bitSize     int
+		expected    uint64
+		expectedErr string
+	}{
+		{value: "42", bitSize: 32, expected: 42},
+		{value: "0x3DA3358B4DC173", bitSize: 64, expected: 0x3DA3358B4DC173},
+		{value: "0xffffffff", bitSize: 32, expected: 0xffffffff},
+		{value: "0x100000000", bitSize: 32, expectedErr: "invalid number: 0x100000000"},
+		{value: "-1", bitSize: 32, expectedErr: "invalid number: -1"},
+		{value: "poly", bitSize: 64, expectedErr: "invalid number: poly"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			n, err := parseUint(tt.value, tt.bitSize)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "parseUint should not return error")
+			assert.Equal(t, tt.expected, n, "Number should be as expected")
+		})
+	}
+}
+
+func TestParseBuzhashTable(t *testing.T) {
+	var tests = []struct {
+		value       string
+		expected    []uint32
+		expectedErr string
+	}{
+		{value: "1 2\n3", expected: []uint32{1, 2, 3}},
+		{value: "0x458be752, 0xc10748cc,\n\t0xfbbcdbb8,", expected: []uint32{0x458be752, 0xc10748cc, 0xfbbcdbb8}},
+		{value: "", expected: []uint32{}},
+		{value: "1, 0x100000000", expectedErr: "invalid number: 0x100000000"},
+		{value: "1;2", expectedErr: "invalid number: 1;2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			table, err := parseBuzhashTable(tt.value)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "parseBuzhashTable should not return error")
+			assert.Equal(t, tt.expected, table, "Table should be as expected")
+		})
+	}
+}
+
+func TestProcessArguments(t *testing.T) {
+	var dir = t.TempDir()
+	var basis = filepath.Join(dir, "basis")
+	var output = filepath.Join(dir, "output")
+
+	err := os.WriteFile(basis, []byte("basis"), 0644)
+	assert.NoError(t, err, "WriteFile should not return error")
+
+	var tests = []struct {
+		name           string
+		args           []string
+		expectedStdin0 bool
+		expectedStdin1 bool
+		expectedOutput string
+		expectedErr    string
+	}{
+		{
+			name:           "Signature from stdin to stdout",
+			args:           []string{"signature"},
+			expectedStdin0: true,
+		},
+		{
+			name:           "Signature with dash arguments",
+			args:           []string{"signature", "-", "-"},
+			expectedStdin0: true,
+		},
+		{
+			name:           "Signature to file",
+			args:           []string{"signature", "-", output},
+			expectedStdin0: true,
+			expectedOutput: output,
+		},
+		{
+			name:           "Delta of stdin",
+			args:           []string{"delta", basis},
+			expectedStdin1: true,
+		},
+		{
+			name:           "Delta of signature from stdin",
+			args:           []string{"delta", "-", basis, output},
+			expectedStdin0: true,
+			expectedOutput: output,
+		},
+		{
+			name:        "Delta without signature",
+			args:        []string{"delta"},
+			expectedErr: "argument \"SIGNATURE\" is missing",
+		},
+		{
+			name:        "Delta with both inputs from stdin",
+			args:        []string{"delta", "-", "-"},
+			expectedErr: "SIGNATURE and NEWFILE can not both be read from stdin",
+		},
+		{
+			name:           "Patch from delta of stdin",
+			args:           []string{"patch", basis, "-"},
+			expectedStdin1: true,
+		},
+		{
+			name:        "Patch without delta",
+			args:        []string{"patch", basis},
+			expectedErr: "argument \"DELTA\" is missing",
+		},
+		{
+			name:        "Patch of basis from stdin",
+			args:        []string{"patch", "-", basis},
+			expectedErr: "BASIS can not be read from stdin",
+		},
+		{
+			name: "Diff to stdout",
+			args: []string{"diff", basis, basis},
+		},
+		{
+			name:           "Diff of new file from stdin",
+			args:           []string{"diff", basis, "-", output},
+			expectedStdin1: true,
+			expectedOutput: output,
+		},
+		{
+			name:        "Diff without new file",
+			args:        []string{"diff", basis},
+			expectedErr: "argument \"NEWFILE\" is missing",
+		},
+		{
+			name:        "Diff with both inputs from stdin",
+			args:        []string{"diff", "-", "-"},
+			expectedErr: "BASIS and NEWFILE can not both be read from stdin",
+		},
+		{
+			name: "Inspect file",
+			args: []string{"inspect", basis},
+		},
+		{
+			name:           "Inspect stdin",
+			args:           []string{"inspect"},
+			expectedStdin0: true,
+		},
+		{
+			name:        "Inspect missing file",
+			args:        []string{"inspect", filepath.Join(dir, "missing")},
+			expectedErr: "FILE file does not exist: " + filepath.Join(dir, "missing"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := processArguments(tt.args, false)
+
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err, "processArguments should not return error")
+			assert.Equal(t, tt.expectedStdin0, cmd.file0 == os.Stdin, "First input should be stdin when expected")
+			assert.Equal(t, tt.expectedStdin1, cmd.file1 == os.Stdin, "Second input should be stdin when expected")
+			assert.Equal(t, tt.expectedOutput, cmd.outputFile, "Output file should be as expected")
+
+			for _, f := range []*os.File{cmd.file0, cmd.file1} {
+				if f != nil && f != os.Stdin {
+					f.Close()
+				}
+			}
+		})
+	}
+}